@@ -2,10 +2,12 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/yuin/yammy"
 	"go.yaml.in/yaml/v3"
@@ -13,15 +15,55 @@ import (
 
 func abortIf(err error) {
 	if err != nil {
+		// yammy.Errors prints errors with their positions
+		if _, ok := err.(yammy.Errors); !ok {
+			err = yammy.Errors{err}
+		}
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
 }
 
+// stringsFlag is a flag that can be specified multiple times.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+// readVarsFile reads a YAML mapping that has scalar values.
+func readVarsFile(path string) (map[string]string, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var nodes map[string]yaml.Node
+	if err := yaml.Unmarshal(bs, &nodes); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	vars := map[string]string{}
+	for name, n := range nodes {
+		if n.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("%s: variable %s must be a scalar node", path, name)
+		}
+		vars[name] = n.Value
+		if n.ShortTag() == "!!str" {
+			// quoted values are strings even if they look like numbers(i.e. "8080")
+			vars[name] = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(n.Value) + `"`
+		}
+	}
+	return vars, nil
+}
+
 func main() {
 	generateCmd := flag.NewFlagSet("generate", flag.ExitOnError)
 	generateHelp := generateCmd.Bool("h", false, "show this help")
-	generateInput := generateCmd.String("i", "", "source file path(required)")
+	generateInput := generateCmd.String("i", "", "source file path(required, - means stdin)")
 	generateOutput := generateCmd.String("o", "", "output file path(optional)")
 	generateFormat := generateCmd.String("f", "yaml", "output format(yaml or json)")
 	generateSourceMapComment := generateCmd.Bool("c", false, "add source map comments")
@@ -29,6 +71,16 @@ func main() {
 	generateRemovesBlockComments := generateCmd.Bool("b", false, "remove block comments(optional)")
 	generateSourceMap := generateCmd.String("s", "", "source map node key name")
 	generateEnvJSONPatches := generateCmd.String("p", "JSON_PATCH", "JSON Patch env key prefix")
+	generateKeyOrder := generateCmd.String("key-order", "sorted", "order of added mapping keys(sorted, source or append)")
+	generateAllErrors := generateCmd.Bool("all-errors", false, "report all errors instead of the first one(optional)")
+	var generateDotEnvFiles stringsFlag
+	generateCmd.Var(&generateDotEnvFiles, "e", "dotenv file path(optional, can be specified multiple times)")
+	var generateVars stringsFlag
+	generateCmd.Var(&generateVars, "v", "variable like name=value(optional, can be specified multiple times)")
+	generateVarsFile := generateCmd.String("vars-file", "", "YAML file path that defines variables(optional)")
+	generateCacheDir := generateCmd.String("cache-dir", "", "cache directory for remote includes(optional)")
+	generateOffline := generateCmd.Bool("offline", false, "use only cached remote includes(optional)")
+	generateProfile := generateCmd.String("profile", "", "comma separated profile names like prod,eu(optional)")
 
 	cmdName := "generate"
 	args := []string{}
@@ -54,7 +106,7 @@ redo:
 			os.Exit(1)
 		}
 
-		var n yaml.Node
+		var docs []yaml.Node
 		var opts []yammy.LoadOption
 		if *generateSourceMapComment {
 			opts = append(opts, yammy.WithSourceMapComment())
@@ -71,16 +123,70 @@ redo:
 		if len(*generateEnvJSONPatches) != 0 {
 			opts = append(opts, yammy.WithEnvJSONPatches(*generateEnvJSONPatches))
 		}
-		abortIf(yammy.Load(*generateInput, &n, opts...))
+		opts = append(opts, yammy.WithKeyOrder(yammy.KeyOrder(*generateKeyOrder)))
+		if *generateAllErrors {
+			opts = append(opts, yammy.WithErrorCollection())
+		}
+		if len(generateDotEnvFiles) != 0 {
+			opts = append(opts, yammy.WithDotEnvFiles(generateDotEnvFiles...))
+		}
+		if len(*generateVarsFile) != 0 {
+			vars, err := readVarsFile(*generateVarsFile)
+			abortIf(err)
+			opts = append(opts, yammy.WithVariables(vars))
+		}
+		if len(generateVars) != 0 {
+			vars := map[string]string{}
+			for _, v := range generateVars {
+				name, value, ok := strings.Cut(v, "=")
+				if !ok {
+					abortIf(fmt.Errorf("invalid variable(name=value is expected): %s", v))
+				}
+				vars[name] = value
+			}
+			opts = append(opts, yammy.WithVariables(vars))
+		}
+		if len(*generateProfile) != 0 {
+			opts = append(opts, yammy.WithProfiles(strings.Split(*generateProfile, ",")...))
+		}
+		opts = append(opts, yammy.WithIncludeFetcher(&yammy.HTTPIncludeFetcher{
+			CacheDir: *generateCacheDir,
+			Offline:  *generateOffline,
+		}))
+		if *generateInput == "-" {
+			abortIf(yammy.LoadAllReader("<stdin>", os.Stdin, &docs, opts...))
+		} else {
+			abortIf(yammy.LoadAll(*generateInput, &docs, opts...))
+		}
 		var err error
 		var bs []byte
 		switch *generateFormat {
 		case "yaml":
-			bs, err = yaml.Marshal(&n)
+			var buf bytes.Buffer
+			encoder := yaml.NewEncoder(&buf)
+			for i := range docs {
+				abortIf(encoder.Encode(&docs[i]))
+			}
+			err = encoder.Close()
+			bs = buf.Bytes()
 		case "json":
-			var m map[string]any
-			abortIf(n.Decode(&m))
-			bs, err = json.MarshalIndent(m, "", "  ")
+			// multiple documents are written as JSON Lines(one compact document per line)
+			for i := range docs {
+				var m map[string]any
+				abortIf(docs[i].Decode(&m))
+				var jbs []byte
+				var jerr error
+				if len(docs) == 1 {
+					jbs, jerr = json.MarshalIndent(m, "", "  ")
+				} else {
+					jbs, jerr = json.Marshal(m)
+				}
+				abortIf(jerr)
+				if i != 0 {
+					bs = append(bs, '\n')
+				}
+				bs = append(bs, jbs...)
+			}
 		}
 		abortIf(err)
 		if len(*generateOutput) != 0 {
@@ -0,0 +1,377 @@
+package yammy
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// condExpr is a parsed 'when' condition.
+//
+// Conditions support string literals, variables like '${ENV}' , bare words like
+// 'prod' , '==' , '!=' , 'defined(NAME)' , 'and' , 'or' , 'not' and parentheses.
+type condExpr interface {
+	Eval(lookup varLookup) (bool, error)
+}
+
+// condLookup is a varLookup for conditions. References like '${/a/b}' can not be used
+// because conditions are evaluated before files are merged.
+type condLookup struct {
+	varLookup
+}
+
+func (l condLookup) Lookup(key string) (string, string, error) {
+	if isReference(key) {
+		return "", "", ErrDirective.New("references can not be used in conditions: %s", nil, key)
+	}
+	return l.varLookup.Lookup(key)
+}
+
+// condEmptyLookup is a varLookup that resolves undefined variables as empty strings.
+type condEmptyLookup struct {
+	varLookup
+}
+
+func (l condEmptyLookup) Lookup(key string) (string, string, error) {
+	v, tag, err := l.varLookup.Lookup(key)
+	if errors.Is(err, ErrVarNotFound) {
+		return "", "", nil
+	}
+	return v, tag, err
+}
+
+type condAnd struct {
+	Left, Right condExpr
+}
+
+func (e *condAnd) Eval(lookup varLookup) (bool, error) {
+	ok, err := e.Left.Eval(lookup)
+	if err != nil || !ok {
+		return false, err
+	}
+	return e.Right.Eval(lookup)
+}
+
+type condOr struct {
+	Left, Right condExpr
+}
+
+func (e *condOr) Eval(lookup varLookup) (bool, error) {
+	ok, err := e.Left.Eval(lookup)
+	if err != nil || ok {
+		return ok, err
+	}
+	return e.Right.Eval(lookup)
+}
+
+type condNot struct {
+	Expr condExpr
+}
+
+func (e *condNot) Eval(lookup varLookup) (bool, error) {
+	ok, err := e.Expr.Eval(lookup)
+	if err != nil {
+		return false, err
+	}
+	return !ok, nil
+}
+
+type condDefined struct {
+	Name string
+}
+
+func (e *condDefined) Eval(lookup varLookup) (bool, error) {
+	v, _, err := lookup.Lookup(e.Name)
+	if err != nil {
+		if errors.Is(err, ErrVarNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return len(v) != 0, nil
+}
+
+type condCompare struct {
+	Left, Right *condOperand
+	NotEqual    bool
+}
+
+func (e *condCompare) Eval(lookup varLookup) (bool, error) {
+	l, err := e.Left.Value(lookup)
+	if err != nil {
+		return false, err
+	}
+	r, err := e.Right.Value(lookup)
+	if err != nil {
+		return false, err
+	}
+	return (l == r) != e.NotEqual, nil
+}
+
+type condBool struct {
+	Operand *condOperand
+}
+
+func (e *condBool) Eval(lookup varLookup) (bool, error) {
+	v, err := e.Operand.Value(lookup)
+	if err != nil {
+		return false, err
+	}
+	if len(v) == 0 {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s is not a boolean", e.Operand.Text)
+	}
+	return b, nil
+}
+
+type condOperand struct {
+	Text       string
+	IsVariable bool
+}
+
+// Value returns a value of the operand. Variables are expanded in the same way as values in YAML files,
+// but undefined variables without default values are empty strings.
+func (o *condOperand) Value(lookup varLookup) (string, error) {
+	if !o.IsVariable {
+		return o.Text, nil
+	}
+	v, err := expandVar(o.Text, lookup, false, o.Text)
+	if errors.Is(err, ErrVarNotFound) {
+		// required variables still return errors
+		v, err = expandVar(o.Text, condEmptyLookup{lookup}, false, o.Text)
+	}
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(v, `"`) {
+		if s, err := strconv.Unquote(v); err == nil {
+			return s, nil
+		}
+	}
+	return v, nil
+}
+
+type condTokenKind int
+
+const (
+	condTokenEOF condTokenKind = iota
+	condTokenWord
+	condTokenString
+	condTokenVariable
+	condTokenEqual
+	condTokenNotEqual
+	condTokenLParen
+	condTokenRParen
+)
+
+type condToken struct {
+	Kind condTokenKind
+	Text string
+}
+
+func tokenizeCondition(expr string) ([]condToken, error) {
+	var tokens []condToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(':
+			tokens = append(tokens, condToken{Kind: condTokenLParen, Text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, condToken{Kind: condTokenRParen, Text: ")"})
+			i++
+		case strings.HasPrefix(expr[i:], "=="):
+			tokens = append(tokens, condToken{Kind: condTokenEqual, Text: "=="})
+			i += 2
+		case strings.HasPrefix(expr[i:], "!="):
+			tokens = append(tokens, condToken{Kind: condTokenNotEqual, Text: "!="})
+			i += 2
+		case strings.HasPrefix(expr[i:], "${"):
+			depth := 0
+			j := i
+			for ; j < len(expr); j++ {
+				if expr[j] == '{' {
+					depth++
+				} else if expr[j] == '}' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			if j == len(expr) {
+				return nil, fmt.Errorf("unclosed variable: %s", expr[i:])
+			}
+			tokens = append(tokens, condToken{Kind: condTokenVariable, Text: expr[i : j+1]})
+			i = j + 1
+		case c == '"' || c == '\'':
+			value, end := parseVarString(expr, i, c)
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed string: %s", expr[i:])
+			}
+			tokens = append(tokens, condToken{Kind: condTokenString, Text: string(value)})
+			i = end
+		default:
+			j := i
+			for ; j < len(expr) && !strings.ContainsRune(" \t()=!\"'$", rune(expr[j])); j++ { //nolint
+			}
+			if j == i {
+				return nil, fmt.Errorf("unexpected character '%c'", c)
+			}
+			tokens = append(tokens, condToken{Kind: condTokenWord, Text: expr[i:j]})
+			i = j
+		}
+	}
+	return append(tokens, condToken{Kind: condTokenEOF}), nil
+}
+
+// condParser is a recursive descent parser for conditions.
+//
+//	or      = and { "or" and }
+//	and     = unary { "and" unary }
+//	unary   = "not" unary | primary
+//	primary = "(" or ")" | "defined" "(" word ")" | operand [ ( "==" | "!=" ) operand ]
+type condParser struct {
+	tokens []condToken
+	pos    int
+}
+
+func parseCondition(expr string) (condExpr, error) {
+	tokens, err := tokenizeCondition(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &condParser{tokens: tokens}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.Kind != condTokenEOF {
+		return nil, fmt.Errorf("unexpected token '%s'", t.Text)
+	}
+	return e, nil
+}
+
+func (p *condParser) peek() condToken {
+	return p.tokens[p.pos]
+}
+
+func (p *condParser) next() condToken {
+	t := p.tokens[p.pos]
+	if t.Kind != condTokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *condParser) isKeyword(word string) bool {
+	t := p.peek()
+	return t.Kind == condTokenWord && t.Text == word
+}
+
+func (p *condParser) expect(kind condTokenKind, text string) error {
+	if t := p.next(); t.Kind != kind {
+		if t.Kind == condTokenEOF {
+			return fmt.Errorf("'%s' is expected, but got end of the condition", text)
+		}
+		return fmt.Errorf("'%s' is expected, but got '%s'", text, t.Text)
+	}
+	return nil
+}
+
+func (p *condParser) parseOr() (condExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &condOr{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *condParser) parseAnd() (condExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &condAnd{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *condParser) parseUnary() (condExpr, error) {
+	if p.isKeyword("not") {
+		p.next()
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &condNot{Expr: e}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *condParser) parsePrimary() (condExpr, error) {
+	if p.peek().Kind == condTokenLParen {
+		p.next()
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(condTokenRParen, ")")
+	}
+	if p.isKeyword("defined") && p.tokens[p.pos+1].Kind == condTokenLParen {
+		p.next()
+		p.next()
+		t := p.next()
+		if t.Kind != condTokenWord {
+			return nil, fmt.Errorf("a variable name is expected in defined()")
+		}
+		return &condDefined{Name: t.Text}, p.expect(condTokenRParen, ")")
+	}
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	switch p.peek().Kind {
+	case condTokenEqual, condTokenNotEqual:
+		op := p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &condCompare{Left: left, Right: right, NotEqual: op.Kind == condTokenNotEqual}, nil
+	}
+	return &condBool{Operand: left}, nil
+}
+
+func (p *condParser) parseOperand() (*condOperand, error) {
+	t := p.next()
+	switch t.Kind {
+	case condTokenWord, condTokenString:
+		return &condOperand{Text: t.Text}, nil
+	case condTokenVariable:
+		return &condOperand{Text: t.Text, IsVariable: true}, nil
+	case condTokenEOF:
+		return nil, fmt.Errorf("an operand is expected, but got end of the condition")
+	}
+	return nil, fmt.Errorf("an operand is expected, but got '%s'", t.Text)
+}
@@ -0,0 +1,149 @@
+package yammy_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/yuin/yammy"
+)
+
+func TestConditions(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  envFiles:
+    - test.env
+  variables:
+    region: us
+  include:
+    - base.yml
+    - path: prod.yml
+      when: ${ENV} == "prod"
+    - path: dev.yml
+      when: ${ENV} != prod and not defined(CI) and not defined(unknown:CI)
+    - path: feature.yml
+      when: defined(FEATURE_X) and ${FEATURE_X}
+    - path: region.yml
+      when: (${region} == 'eu' or ${region} == "us") and ${ENV:dev} == ${env:ENV}
+    - path: tier.yml
+      when: ${TIER} == gold and ${UNDEFINED} == "" and not ${UNDEFINED}
+  patches:
+    - op: add
+      path: /debug
+      value: true
+      when: ${ENV} == dev
+    - op: add
+      path: /replicas
+      value: 3
+name: test
+`),
+		"base.yml":    []byte("base: 1\n"),
+		"prod.yml":    []byte("prod: 1\n"),
+		"dev.yml":     []byte("dev: 1\n"),
+		"feature.yml": []byte("feature: 1\n"),
+		"region.yml":  []byte("region: ${region}\n"),
+		"tier.yml":    []byte("tier: ${TIER}\n"),
+		"test.env":    []byte("TIER=gold\n"),
+	})
+	cases := []struct {
+		name     string
+		env      map[string]string
+		expected string
+	}{
+		{
+			name:     "prod",
+			env:      map[string]string{"ENV": "prod", "FEATURE_X": "true"},
+			expected: `{"base":1,"feature":1,"name":"test","prod":1,"region":"us","replicas":3,"tier":"gold"}`,
+		},
+		{
+			name:     "dev",
+			env:      map[string]string{"ENV": "dev", "FEATURE_X": "false"},
+			expected: `{"base":1,"debug":true,"dev":1,"name":"test","region":"us","replicas":3,"tier":"gold"}`,
+		},
+		{
+			name:     "ci",
+			env:      map[string]string{"ENV": "dev", "CI": "1"},
+			expected: `{"base":1,"debug":true,"name":"test","region":"us","replicas":3,"tier":"gold"}`,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := func(key string) (string, error) {
+				if v, ok := tt.env[key]; ok {
+					return v, nil
+				}
+				return "", ErrVarNotFound.New("%s not found", nil, key)
+			}
+			var result map[string]any
+			err := Load("test.yml", &result, WithFileSystem(fs), WithVarResolver(resolver),
+				WithVarNamespace("env", resolver))
+			if err != nil {
+				t.Fatal(err)
+			}
+			bs, err := json.Marshal(result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.expected != string(bs) {
+				t.Errorf("expected:\n--------------\n%s\n\nactual:\n---------------\n%s\n",
+					tt.expected, string(bs))
+			}
+		})
+	}
+}
+
+func TestConditionError(t *testing.T) {
+	cases := []struct {
+		name     string
+		when     string
+		expected string
+	}{
+		{
+			name: "syntax",
+			when: `${ENV} == "prod" and`,
+			expected: "directive error: test.yml(line:5): invalid condition: " +
+				"an operand is expected, but got end of the condition: yammy error",
+		},
+		{
+			name: "paren",
+			when: `(${ENV} == "prod"`,
+			expected: "directive error: test.yml(line:5): invalid condition: " +
+				"')' is expected, but got end of the condition: yammy error",
+		},
+		{
+			name:     "required",
+			when:     `${ENV:?} == "prod"`,
+			expected: "variable not found: ${ENV:?}: ENV is required: yammy error",
+		},
+		{
+			name:     "notBoolean",
+			when:     `${NAME:aaa}`,
+			expected: "directive error: test.yml(line:5): ${NAME:aaa} is not a boolean: yammy error",
+		},
+		{
+			name:     "reference",
+			when:     `${/name} == test`,
+			expected: "directive error: references can not be used in conditions: /name: yammy error",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newMockFS(map[string][]byte{
+				"test.yml": []byte(`
+_directives:
+  include:
+    - path: base.yml
+      when: '` + tt.when + `'
+name: test
+`),
+			})
+			var result map[string]any
+			err := Load("test.yml", &result, WithFileSystem(fs), WithVarResolver(func(key string) (string, error) {
+				return "", ErrVarNotFound.New("%s not found", nil, key)
+			}))
+			if err == nil || tt.expected != err.Error() {
+				t.Errorf("unexpected error message: %v", err)
+			}
+		})
+	}
+}
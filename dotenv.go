@@ -0,0 +1,96 @@
+package yammy
+
+import (
+	"strings"
+)
+
+// parseDotEnv parses dotenv formatted data.
+// parseDotEnv supports comments, single and double quoted values,
+// 'export' prefixes and multi-line quoted values.
+func parseDotEnv(path string, bs []byte) (map[string]string, error) {
+	ret := map[string]string{}
+	lines := strings.Split(strings.ReplaceAll(string(bs), "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNumber := i + 1
+		line := strings.TrimSpace(lines[i])
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			return nil, dotEnvError(path, lineNumber, "'=' is expected")
+		}
+		key := strings.TrimSpace(line[:eq])
+		if len(key) == 0 || strings.ContainsAny(key, " \t") {
+			return nil, dotEnvError(path, lineNumber, "invalid key")
+		}
+		value := strings.TrimSpace(line[eq+1:])
+		if len(value) == 0 || (value[0] != '"' && value[0] != '\'') {
+			if c := strings.Index(value, " #"); c > -1 {
+				value = strings.TrimSpace(value[:c])
+			}
+			ret[key] = value
+			continue
+		}
+
+		q := value[0]
+		value = value[1:]
+		var buf strings.Builder
+		closed := false
+		for {
+			for j := 0; j < len(value); j++ {
+				c := value[j]
+				if q == '"' && c == '\\' && j != len(value)-1 {
+					j++
+					switch value[j] {
+					case 'n':
+						buf.WriteByte('\n')
+					case 't':
+						buf.WriteByte('\t')
+					case 'r':
+						buf.WriteByte('\r')
+					default:
+						buf.WriteByte(value[j])
+					}
+					continue
+				}
+				if c == q {
+					rest := strings.TrimSpace(value[j+1:])
+					if len(rest) != 0 && !strings.HasPrefix(rest, "#") {
+						return nil, dotEnvError(path, i+1, "unexpected characters after a quoted value")
+					}
+					closed = true
+					break
+				}
+				buf.WriteByte(c)
+			}
+			if closed {
+				break
+			}
+			i++
+			if i == len(lines) {
+				return nil, dotEnvError(path, lineNumber, "unterminated quoted value")
+			}
+			buf.WriteByte('\n')
+			value = lines[i]
+		}
+		ret[key] = buf.String()
+	}
+	return ret, nil
+}
+
+func dotEnvError(path string, line int, message string) error {
+	err := ErrDirective.New("%s(line:%d): failed to parse a dotenv file: %s", nil, path, line, message).InFile(path)
+	err.line = line
+	return err
+}
+
+func newDotEnvVarResolver(values map[string]string) VarResolver {
+	return func(key string) (string, error) {
+		if v, ok := values[key]; ok {
+			return v, nil
+		}
+		return "", ErrVarNotFound.New("%s not found", nil, key)
+	}
+}
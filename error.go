@@ -3,6 +3,9 @@ package yammy
 import (
 	"errors"
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
 var _ error = (*wrappedError)(nil)
@@ -19,20 +22,235 @@ var ErrYAML = defineError("yaml error", Err)
 // ErrDirective is an error related to yammy directives.
 var ErrDirective = defineError("directive error", Err)
 
+// ErrIncludeCycle is an error that means included files include
+// each other.
+var ErrIncludeCycle = defineError("include cycle detected", ErrDirective)
+
 // ErrVarNotFound is an error that means variables used in a
 // YAML not found.
 var ErrVarNotFound = defineError("variable not found", Err)
 
+// ErrorKind is a kind of [Error] .
+type ErrorKind int
+
+const (
+	// ErrorKindUnknown is an unknown error kind.
+	ErrorKindUnknown ErrorKind = iota
+
+	// ErrorKindIO means [ErrIO] .
+	ErrorKindIO
+
+	// ErrorKindYAML means [ErrYAML] .
+	ErrorKindYAML
+
+	// ErrorKindDirective means [ErrDirective] .
+	ErrorKindDirective
+
+	// ErrorKindVarNotFound means [ErrVarNotFound] .
+	ErrorKindVarNotFound
+)
+
+// String implements [fmt.Stringer] .
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorKindIO:
+		return "IO"
+	case ErrorKindYAML:
+		return "YAML"
+	case ErrorKindDirective:
+		return "Directive"
+	case ErrorKindVarNotFound:
+		return "VarNotFound"
+	}
+	return "Unknown"
+}
+
+// Error is an error with a position in source files.
+// Errors returned by yammy can be converted into an Error with [errors.As] .
+// Position fields are zero values if the position is unknown.
+type Error struct {
+	// Kind is a kind of this error.
+	Kind ErrorKind
+
+	// File is a file path that contains the error.
+	File string
+
+	// Line is a line in the File.
+	Line int
+
+	// Column is a column in the File.
+	Column int
+
+	// Path is a JSON Pointer of the node that causes the error.
+	Path string
+
+	// IncludeChain is a list of files from the root file to the File.
+	IncludeChain []string
+
+	// Err is the original error.
+	Err error
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the original error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Errors is a list of errors that are collected while loading files
+// with [WithErrorCollection] .
+type Errors []error
+
+// Error implements error. Error returns messages separated by newlines.
+// Each message is prefixed with a position like 'file:line:column: ' if the
+// position is known.
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, formatWithPosition(err))
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func formatWithPosition(err error) string {
+	msg := err.Error()
+	var yerr *Error
+	if !errors.As(err, &yerr) || len(yerr.File) == 0 {
+		return msg
+	}
+	if yerr.Line == 0 {
+		return yerr.File + ": " + msg
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", yerr.File, yerr.Line, yerr.Column, msg)
+}
+
+// Is returns true if one of the errors matches the target.
+func (e Errors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error that matches the target.
+func (e Errors) As(target any) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+type errorCollector struct {
+	enabled bool
+	errs    Errors
+}
+
+// Collect records the err and returns nil if error collection is enabled.
+// Otherwise, Collect returns the err as it is.
+func (c *errorCollector) Collect(err error) error {
+	if err == nil || c == nil || !c.enabled {
+		return err
+	}
+	if errs, ok := err.(Errors); ok {
+		c.errs = append(c.errs, errs...)
+	} else {
+		c.errs = append(c.errs, err)
+	}
+	return nil
+}
+
+// Err returns collected errors with include chains. If a fatal err is given,
+// it is returned together with collected errors.
+func (c *errorCollector) Err(err error, chains map[string][]string) error {
+	if c == nil || !c.enabled {
+		if err == nil {
+			return nil
+		}
+		return withIncludeChain(err, chains)
+	}
+	_ = c.Collect(err)
+	if len(c.errs) == 0 {
+		return nil
+	}
+	for _, e := range c.errs {
+		withIncludeChain(e, chains)
+	}
+	return c.errs
+}
+
+func errorAt(err error, n *node, path string) error {
+	if err == nil {
+		return nil
+	}
+	if we, ok := err.(*wrappedError); ok && we.isSentinel() {
+		return &Error{
+			Kind:   we.kind(),
+			File:   n.File,
+			Line:   n.Line,
+			Column: n.Column,
+			Path:   path,
+			Err:    err,
+		}
+	}
+	var yerr *Error
+	if errors.As(err, &yerr) && len(yerr.File) != 0 {
+		return err
+	}
+	if we, ok := err.(*wrappedError); ok {
+		return we.At(n).WithPath(path)
+	}
+	return &Error{
+		Kind:   ErrorKindUnknown,
+		File:   n.File,
+		Line:   n.Line,
+		Column: n.Column,
+		Path:   path,
+		Err:    err,
+	}
+}
+
+func withIncludeChain(err error, chains map[string][]string) error {
+	switch e := err.(type) {
+	case *wrappedError:
+		if e.includeChain == nil && !e.isSentinel() {
+			e.includeChain = chains[e.file]
+		}
+	case *Error:
+		if e.IncludeChain == nil {
+			e.IncludeChain = chains[e.File]
+		}
+	}
+	return err
+}
+
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+):`)
+
 type wrappedError struct {
-	message string
-	parent  *wrappedError
-	cause   error
+	message  string
+	parent   *wrappedError
+	cause    error
+	sentinel bool
+
+	file         string
+	line         int
+	column       int
+	path         string
+	includeChain []string
 }
 
 func defineError(message string, parent *wrappedError) *wrappedError {
 	return &wrappedError{
-		message: message,
-		parent:  parent,
+		message:  message,
+		parent:   parent,
+		sentinel: true,
 	}
 }
 
@@ -47,6 +265,69 @@ func (e *wrappedError) New(message string, cause error, args ...any) *wrappedErr
 	}
 }
 
+// At sets a position of n to this error.
+func (e *wrappedError) At(n *node) *wrappedError {
+	e.file = n.File
+	e.line = n.Line
+	e.column = n.Column
+	return e
+}
+
+// InFile sets a file to this error. A line is set if the cause
+// is a YAML syntax error.
+func (e *wrappedError) InFile(file string) *wrappedError {
+	e.file = file
+	if e.cause != nil {
+		if m := yamlErrorLine.FindStringSubmatch(e.cause.Error()); m != nil {
+			e.line, _ = strconv.Atoi(m[1])
+		}
+	}
+	return e
+}
+
+// WithPath sets a JSON Pointer to this error.
+func (e *wrappedError) WithPath(path string) *wrappedError {
+	e.path = path
+	return e
+}
+
+func (e *wrappedError) isSentinel() bool {
+	return e.sentinel
+}
+
+func (e *wrappedError) kind() ErrorKind {
+	for p := e; p != nil; p = p.parent {
+		switch p {
+		case ErrIO:
+			return ErrorKindIO
+		case ErrYAML:
+			return ErrorKindYAML
+		case ErrDirective:
+			return ErrorKindDirective
+		case ErrVarNotFound:
+			return ErrorKindVarNotFound
+		}
+	}
+	return ErrorKindUnknown
+}
+
+func (e *wrappedError) As(target any) bool {
+	t, ok := target.(**Error)
+	if !ok {
+		return false
+	}
+	*t = &Error{
+		Kind:         e.kind(),
+		File:         e.file,
+		Line:         e.line,
+		Column:       e.column,
+		Path:         e.path,
+		IncludeChain: e.includeChain,
+		Err:          e,
+	}
+	return true
+}
+
 func (e *wrappedError) Is(other error) bool {
 	return e != nil && (e == other || errors.Is(e.parent, other) || errors.Is(e.cause, other))
 }
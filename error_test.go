@@ -0,0 +1,220 @@
+package yammy_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "github.com/yuin/yammy"
+)
+
+func TestError(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - child.yml
+  patches:
+    - op: remove
+      path: /test/value2
+test:
+  value: 10
+`),
+		"vars.yml": []byte(`
+_directives:
+  include:
+    - child.yml
+`),
+		"child.yml": []byte(`
+child:
+  value: ${KEY}
+`),
+		"invalid.yml": []byte(`
+test:
+  value: [
+`),
+	})
+	cases := []struct {
+		name     string
+		file     string
+		resolver VarResolver
+		expected Error
+	}{
+		{
+			name: "directive",
+			file: "test.yml",
+			resolver: func(_ string) (string, error) {
+				return "aaa", nil
+			},
+			expected: Error{
+				Kind:         ErrorKindDirective,
+				File:         "test.yml",
+				Line:         6,
+				Column:       7,
+				Path:         "/test/value2",
+				IncludeChain: []string{"test.yml"},
+			},
+		},
+		{
+			name: "varNotFound",
+			file: "vars.yml",
+			resolver: func(key string) (string, error) {
+				return "", ErrVarNotFound.New("%s not found", nil, key)
+			},
+			expected: Error{
+				Kind:         ErrorKindVarNotFound,
+				File:         "child.yml",
+				Line:         3,
+				Column:       10,
+				Path:         "/child/value",
+				IncludeChain: []string{"vars.yml", "child.yml"},
+			},
+		},
+		{
+			name: "sentinel",
+			file: "vars.yml",
+			resolver: func(_ string) (string, error) {
+				return "", ErrIO
+			},
+			expected: Error{
+				Kind:         ErrorKindIO,
+				File:         "child.yml",
+				Line:         3,
+				Column:       10,
+				Path:         "/child/value",
+				IncludeChain: []string{"vars.yml", "child.yml"},
+			},
+		},
+		{
+			name: "yaml",
+			file: "invalid.yml",
+			expected: Error{
+				Kind:         ErrorKindYAML,
+				File:         "invalid.yml",
+				Line:         3,
+				IncludeChain: nil,
+			},
+		},
+		{
+			name: "io",
+			file: "notfound.yml",
+			expected: Error{
+				Kind: ErrorKindIO,
+				File: "notfound.yml",
+			},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var result map[string]any
+			opts := []LoadOption{WithFileSystem(fs)}
+			if tt.resolver != nil {
+				opts = append(opts, WithVarResolver(tt.resolver))
+			}
+			err := Load(tt.file, &result, opts...)
+			var yerr *Error
+			if !errors.As(err, &yerr) {
+				t.Fatalf("err should be an *Error, but got %v", err)
+			}
+			if yerr.Error() != err.Error() {
+				t.Errorf("Error() should be '%s', but got '%s'", err.Error(), yerr.Error())
+			}
+			yerr.Err = nil
+			if !reflect.DeepEqual(&tt.expected, yerr) {
+				t.Errorf("expected:\n%#v\nactual:\n%#v", &tt.expected, yerr)
+			}
+		})
+	}
+
+	err := Load("vars.yml", nil, WithFileSystem(fs), WithVarResolver(func(_ string) (string, error) {
+		return "", ErrIO
+	}))
+	if !errors.Is(err, ErrIO) {
+		t.Errorf("err should be an ErrIO")
+	}
+	if "yammy error: io error" != err.Error() {
+		t.Errorf("unexpected error message: %s", err.Error())
+	}
+	if ErrorKindVarNotFound.String() != "VarNotFound" {
+		t.Errorf("unexpected kind name: %s", ErrorKindVarNotFound.String())
+	}
+}
+
+func TestErrorCollection(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - child.yml
+    - notfound.yml
+  patches:
+    - op: remove
+      path: /test/value2
+    - op: test
+      path: /test/value
+      value: 11
+test:
+  value: 10
+`),
+		"child.yml": []byte(`
+child:
+  value: ${KEY}
+  other: ${OTHER}
+`),
+	})
+	resolver := func(key string) (string, error) {
+		return "", ErrVarNotFound.New("%s not found", nil, key)
+	}
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs), WithVarResolver(resolver))
+	var yerr *Error
+	if !errors.As(err, &yerr) || yerr.File != "test.yml" || yerr.Line != 5 {
+		t.Errorf("Load should return the first error without WithErrorCollection: %v", err)
+	}
+
+	err = Load("test.yml", &result, WithFileSystem(fs), WithVarResolver(resolver), WithErrorCollection())
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("err should be an Errors, but got %v", err)
+	}
+	expected := []Error{
+		{Kind: ErrorKindIO, File: "test.yml", Line: 5, Column: 7, IncludeChain: []string{"test.yml"}},
+		{Kind: ErrorKindDirective, File: "test.yml", Line: 7, Column: 7, Path: "/test/value2",
+			IncludeChain: []string{"test.yml"}},
+		{Kind: ErrorKindDirective, File: "test.yml", Line: 9, Column: 7, Path: "/test/value",
+			IncludeChain: []string{"test.yml"}},
+		{Kind: ErrorKindVarNotFound, File: "child.yml", Line: 3, Column: 10, Path: "/child/value",
+			IncludeChain: []string{"test.yml", "child.yml"}},
+		{Kind: ErrorKindVarNotFound, File: "child.yml", Line: 4, Column: 10, Path: "/child/other",
+			IncludeChain: []string{"test.yml", "child.yml"}},
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("%d errors expected, but got %d: %v", len(expected), len(errs), err)
+	}
+	for i, e := range errs {
+		var yerr *Error
+		if !errors.As(e, &yerr) {
+			t.Fatalf("errs[%d] should be an *Error, but got %v", i, e)
+		}
+		yerr.Err = nil
+		if !reflect.DeepEqual(&expected[i], yerr) {
+			t.Errorf("errs[%d]: expected:\n%#v\nactual:\n%#v", i, &expected[i], yerr)
+		}
+	}
+	if !errors.Is(err, ErrVarNotFound) || !errors.Is(err, ErrIO) {
+		t.Errorf("Errors should match all collected errors")
+	}
+	expectedMessage := strings.Join([]string{
+		"test.yml:5:7: io error: test.yml: failed to find a included file notfound.yml: file does not exist: yammy error",
+		"test.yml:7:7: directive error: test.yml(line:7): can not remove a value /test/value2(value does not exist): " +
+			"yammy error",
+		"test.yml:9:7: directive error: test.yml(line:9): test failed: /test/value is not equal to the expected value: " +
+			"yammy error",
+		"child.yml:3:10: variable not found: KEY not found: yammy error",
+		"child.yml:4:10: variable not found: OTHER not found: yammy error",
+	}, "\n")
+	if expectedMessage != err.Error() {
+		t.Errorf("unexpected error message: %s", err.Error())
+	}
+}
@@ -0,0 +1,160 @@
+package yammy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// IncludeFetcher fetches included files that are specified by URLs like
+// 'https://example.com/base.yml' .
+type IncludeFetcher interface {
+	// Fetch returns contents of the url.
+	// Fetch should return an error that wraps [fs.ErrNotExist] if the url does not exist.
+	Fetch(url string) ([]byte, error)
+}
+
+// PinnedIncludeFetcher is an [IncludeFetcher] that can fetch files whose
+// contents are pinned by checksums like cached files.
+type PinnedIncludeFetcher interface {
+	IncludeFetcher
+
+	// FetchPinned returns contents of the url whose sha256 checksum is sum(hex encoded).
+	// Contents may differ from the sum, and callers should verify them.
+	FetchPinned(url, sum string) ([]byte, error)
+}
+
+// defaultFetchTimeout is a timeout of requests of [HTTPIncludeFetcher] that has no Client.
+const defaultFetchTimeout = 30 * time.Second
+
+// HTTPIncludeFetcher is an [IncludeFetcher] that fetches files over HTTP(S).
+type HTTPIncludeFetcher struct {
+	// Client is a client that is used for requests.
+	// A client that times out after 30 seconds is used if Client is nil.
+	Client *http.Client
+
+	// CacheDir is a directory that fetched files are cached in.
+	// Files are not cached if CacheDir is empty.
+	// Cached files are used without requests if they match checksums of include entries.
+	CacheDir string
+
+	// Offline reads files only from the CacheDir without any requests.
+	Offline bool
+}
+
+var _ PinnedIncludeFetcher = (*HTTPIncludeFetcher)(nil)
+
+// FetchPinned implements [PinnedIncludeFetcher] .
+func (f *HTTPIncludeFetcher) FetchPinned(u, sum string) ([]byte, error) {
+	if len(f.CacheDir) != 0 {
+		if bs, err := os.ReadFile(f.cachePath(u)); err == nil && sha256Hex(bs) == sum {
+			return bs, nil
+		}
+	}
+	return f.Fetch(u)
+}
+
+// Fetch implements [IncludeFetcher] .
+func (f *HTTPIncludeFetcher) Fetch(u string) ([]byte, error) {
+	if f.Offline {
+		if len(f.CacheDir) == 0 {
+			return nil, fmt.Errorf("%s: cache directory is required in offline mode", u)
+		}
+		bs, err := os.ReadFile(f.cachePath(u))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%s: not cached(offline mode): %w", u, fs.ErrNotExist)
+		}
+		return bs, err
+	}
+	client := f.Client
+	if client == nil {
+		client = &http.Client{Timeout: defaultFetchTimeout}
+	}
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s: %s: %w", u, resp.Status, fs.ErrNotExist)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status: %s", u, resp.Status)
+	}
+	bs, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.CacheDir) != 0 {
+		if err := os.MkdirAll(f.CacheDir, 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(f.cachePath(u), bs, 0o600); err != nil {
+			return nil, err
+		}
+	}
+	return bs, nil
+}
+
+func (f *HTTPIncludeFetcher) cachePath(u string) string {
+	sum := sha256.Sum256([]byte(u))
+	return filepath.Join(f.CacheDir, hex.EncodeToString(sum[:]))
+}
+
+// isURL returns true if the path is a URL like 'https://example.com/base.yml' .
+func isURL(path string) bool {
+	return strings.Contains(path, "://")
+}
+
+// resolveURL resolves the path against the base URL.
+func resolveURL(base, path string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	p, err := url.Parse(filepath.ToSlash(path))
+	if err != nil {
+		return "", err
+	}
+	return b.ResolveReference(p).String(), nil
+}
+
+// resolvePath resolves the path against the base that is a file path or a URL.
+func resolvePath(base, path string) (string, error) {
+	switch {
+	case isURL(path):
+		return path, nil
+	case isURL(base):
+		return resolveURL(base, path)
+	case !filepath.IsAbs(path):
+		return filepath.Join(filepath.Dir(base), path), nil
+	}
+	return path, nil
+}
+
+// parseChecksum parses a checksum like 'sha256:<hex>' .
+func parseChecksum(s string) (string, error) {
+	algorithm, sum, ok := strings.Cut(s, ":")
+	if !ok || algorithm != "sha256" {
+		return "", fmt.Errorf("unsupported checksum %s(sha256:<hex> is expected)", s)
+	}
+	sum = strings.ToLower(sum)
+	if bs, err := hex.DecodeString(sum); err != nil || len(bs) != sha256.Size {
+		return "", fmt.Errorf("invalid sha256 checksum %s", sum)
+	}
+	return sum, nil
+}
+
+func sha256Hex(bs []byte) string {
+	sum := sha256.Sum256(bs)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,120 @@
+package yammy_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/yuin/yammy"
+)
+
+func TestRemoteInclude(t *testing.T) {
+	files := map[string]string{
+		"/configs/base.yml": `
+_directives:
+  include:
+    - common.yml
+  envFiles:
+    - base.env
+base: 1
+region: ${REGION}
+token: ${file:token.txt}
+`,
+		"/configs/common.yml": `
+common: 1
+`,
+		"/configs/base.env":  "REGION=eu\n",
+		"/configs/token.txt": "secret\n",
+	}
+	requests := 0
+	requested := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		requested[r.URL.Path] = true
+		body, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+	sum := sha256.Sum256([]byte(files["/configs/base.yml"]))
+	commonSum := sha256.Sum256([]byte(files["/configs/common.yml"]))
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - path: ` + server.URL + `/configs/base.yml
+      checksum: sha256:` + hex.EncodeToString(sum[:]) + `
+    - ?` + server.URL + `/configs/local.yml
+name: test
+`),
+		"mismatch.yml": []byte(`
+_directives:
+  include:
+    - path: ` + server.URL + `/configs/common.yml
+      checksum: sha256:` + strings.Repeat("0", 64) + `
+`),
+	})
+
+	cacheDir := t.TempDir()
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs), WithIncludeFetcher(&HTTPIncludeFetcher{CacheDir: cacheDir}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"base":1,"common":1,"name":"test","region":"eu","token":"secret"}`
+	if expected != string(bs) {
+		t.Errorf("expected:\n--------------\n%s\n\nactual:\n---------------\n%s\n",
+			expected, string(bs))
+	}
+
+	requested = map[string]bool{}
+	result = nil
+	err = Load("test.yml", &result, WithFileSystem(fs), WithIncludeFetcher(&HTTPIncludeFetcher{CacheDir: cacheDir}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requested["/configs/base.yml"] || !requested["/configs/common.yml"] {
+		t.Errorf("cached files should be used only if they match checksums: %v", requested)
+	}
+
+	requests = 0
+	result = nil
+	err = Load("test.yml", &result, WithFileSystem(fs),
+		WithIncludeFetcher(&HTTPIncludeFetcher{CacheDir: cacheDir, Offline: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, _ = json.Marshal(result)
+	if expected != string(bs) || requests != 0 {
+		t.Errorf("cached files should be used in offline mode(requests: %d): %s", requests, string(bs))
+	}
+
+	err = Load("test.yml", &result, WithFileSystem(fs),
+		WithIncludeFetcher(&HTTPIncludeFetcher{CacheDir: t.TempDir(), Offline: true}))
+	if err == nil || !strings.Contains(err.Error(), "not cached(offline mode)") {
+		t.Errorf("unexpected error message: %v", err)
+	}
+
+	err = Load("mismatch.yml", &result, WithFileSystem(fs), WithIncludeFetcher(&HTTPIncludeFetcher{}))
+	if err == nil || "directive error: mismatch.yml(line:4): checksum mismatch for "+server.URL+
+		"/configs/common.yml(expected sha256:"+strings.Repeat("0", 64)+", but got sha256:"+
+		hex.EncodeToString(commonSum[:])+"): yammy error" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+
+	err = Load("test.yml", &result, WithFileSystem(fs))
+	if err == nil || !strings.Contains(err.Error(), "WithIncludeFetcher is required to include URLs") {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
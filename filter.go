@@ -0,0 +1,138 @@
+package yammy
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+// varFilter is a filter for variables like '${NAME|trimprefix:/}' .
+type varFilter struct {
+	name string
+	arg  string
+}
+
+func (va *vvv) hasFilter(name string) bool {
+	for _, f := range va.filters {
+		if f.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseVarFilters parses filters like '|upper|trimprefix:/' starts at i.
+// parseVarFilters returns filters and an index of the closing brace.
+// If filters are invalid, parseVarFilters returns -1 as the index.
+func parseVarFilters(v string, i int) ([]varFilter, int) {
+	var filters []varFilter
+	for i < len(v) && v[i] == '|' {
+		i++
+		j := i
+		for ; j < len(v) && isVarName(v[j], j-i); j++ { //nolint
+		}
+		f := varFilter{name: v[i:j]}
+		if len(f.name) == 0 {
+			return nil, -1
+		}
+		i = j
+		if i < len(v) && v[i] == ':' {
+			i++
+			if i < len(v) && v[i] == '"' {
+				arg, end := parseVarString(v, i, '"')
+				if end < 0 {
+					return nil, -1
+				}
+				f.arg = string(arg)
+				i = end
+			} else {
+				j := i
+				for ; j < len(v) && v[j] != '|' && v[j] != '}'; j++ { //nolint
+				}
+				f.arg = v[i:j]
+				i = j
+			}
+		}
+		filters = append(filters, f)
+	}
+	if i >= len(v) || v[i] != '}' {
+		return nil, -1
+	}
+	return filters, i
+}
+
+// varFilterNames is a set of names of filters that are applied by applyVarFilters.
+var varFilterNames = map[string]bool{
+	"upper": true, "lower": true, "trim": true, "trimprefix": true, "trimsuffix": true,
+	"b64enc": true, "b64dec": true, "int": true, "quote": true, "default": true, "split": true,
+}
+
+// isVarFilters returns true if known filters start at i like '|upper}' .
+func isVarFilters(v string, i int) bool {
+	filters, end := parseVarFilters(v, i)
+	if end < 0 {
+		return false
+	}
+	for _, f := range filters {
+		if !varFilterNames[f.name] {
+			return false
+		}
+	}
+	return true
+}
+
+// applyVarFilters applies filters to the value and returns a new value and a tag.
+// 'split' filter returns a flow style sequence with the 'seq' tag.
+// where is a position of the value that is used in error messages.
+func applyVarFilters(value, tag string, filters []varFilter, where string) (string, string, error) {
+	for i, f := range filters {
+		switch f.name {
+		case "upper":
+			value = strings.ToUpper(value)
+		case "lower":
+			value = strings.ToLower(value)
+		case "trim":
+			value = strings.TrimSpace(value)
+		case "trimprefix":
+			value = strings.TrimPrefix(value, f.arg)
+		case "trimsuffix":
+			value = strings.TrimSuffix(value, f.arg)
+		case "b64enc":
+			value = base64.StdEncoding.EncodeToString([]byte(value))
+			tag = "str"
+		case "b64dec":
+			bs, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return "", "", ErrYAML.New("%s: failed to decode %s as base64", err, where, value)
+			}
+			value = string(bs)
+			tag = "str"
+		case "int":
+			if _, err := strconv.Atoi(value); err != nil {
+				return "", "", ErrYAML.New("%s: %s is not an integer", nil, where, value)
+			}
+			tag = "int"
+		case "quote":
+			tag = "str"
+		case "default":
+			if len(value) == 0 {
+				value = f.arg
+				tag = guessScalarNodeTag(value)
+			}
+		case "split":
+			if i != len(filters)-1 {
+				return "", "", ErrYAML.New("%s: split filter must be the last filter", nil, where)
+			}
+			var items []string
+			if len(value) != 0 {
+				for _, item := range strings.Split(value, f.arg) {
+					items = append(items, strconv.Quote(item))
+				}
+			}
+			return "[" + strings.Join(items, ", ") + "]", "seq", nil
+		default:
+			return "", "", ErrYAML.New("%s: unknown variable filter %s", nil, where, f.name)
+		}
+	}
+	return value, tag, nil
+}
@@ -2,6 +2,8 @@ package yammy_test
 
 import (
 	"encoding/json"
+	"errors"
+	"reflect"
 	"testing"
 
 	. "github.com/yuin/yammy"
@@ -70,3 +72,368 @@ grand:
 			expected, string(bs))
 	}
 }
+
+func TestIncludeCycle(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"a.yml": []byte(`
+_directives:
+  include:
+    - b.yml
+a: 1
+`),
+		"b.yml": []byte(`
+_directives:
+  include:
+    - c.yml
+    - a.yml
+b: 1
+`),
+		"c.yml": []byte(`
+c: 1
+`),
+	})
+	var result map[string]any
+	err := Load("a.yml", &result, WithFileSystem(fs))
+	expected := "include cycle detected: a.yml(line:4) -> b.yml(line:5) -> a.yml: " +
+		"directive error: yammy error"
+	if err == nil || expected != err.Error() {
+		t.Errorf("err should be '%s', but got %v", expected, err)
+	}
+	if !errors.Is(err, ErrIncludeCycle) || !errors.Is(err, ErrDirective) {
+		t.Errorf("err should be an ErrIncludeCycle")
+	}
+}
+
+func TestIncludeDiamond(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"a.yml": []byte(`
+_directives:
+  include:
+    - b.yml
+    - c.yml
+`),
+		"b.yml": []byte(`
+_directives:
+  include:
+    - d.yml
+`),
+		"c.yml": []byte(`
+_directives:
+  include:
+    - d.yml
+`),
+		"d.yml": []byte(`
+d: 1
+`),
+	})
+	var result map[string]any
+	err := Load("a.yml", &result, WithFileSystem(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if 1 != result["d"] {
+		t.Errorf("failed to include a file twice: %#v", result)
+	}
+}
+
+func TestMaxIncludeDepth(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"a.yml": []byte(`
+_directives:
+  include:
+    - b.yml
+`),
+		"b.yml": []byte(`
+_directives:
+  include:
+    - c.yml
+`),
+		"c.yml": []byte(`
+c: 1
+`),
+	})
+	var result map[string]any
+	err := Load("a.yml", &result, WithFileSystem(fs), WithMaxIncludeDepth(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Load("a.yml", &result, WithFileSystem(fs), WithMaxIncludeDepth(1))
+	expected := "directive error: b.yml(line:4): include depth exceeds 1: " +
+		"a.yml(line:4) -> b.yml(line:4) -> c.yml: yammy error"
+	if err == nil || expected != err.Error() {
+		t.Errorf("err should be '%s', but got %v", expected, err)
+	}
+}
+
+func TestIncludeVariables(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - path: service.yml
+      variables:
+        name: api
+        port: 8080
+    - path: service.yml
+      variables:
+        name: web
+    - common.yml
+`),
+		"service.yml": []byte(`
+_directives:
+  variables:
+    name: default
+services:
+  - name: ${name}
+    port: ${port:80}
+    image: ${registry}/${name}
+`),
+		"common.yml": []byte(`
+_directives:
+  variables:
+    registry: example.com
+common: ${name}
+`),
+	})
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"common":"default","services":[{"image":"example.com/api","name":"api","port":8080},` +
+		`{"image":"example.com/web","name":"web","port":80}]}`
+	if expected != string(bs) {
+		t.Errorf("expected:\n--------------\n%s\n\nactual:\n---------------\n%s\n",
+			expected, string(bs))
+	}
+
+	err = Load("test.yml", &result, WithFileSystem(fs), WithScopedVariables())
+	if err == nil || "variable not found: name not found: yammy error" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+
+	fs = newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  variables:
+    name: root
+  include:
+    - path: s.yml
+      variables:
+        name: api
+    - path: s.yml
+      variables:
+        name: web
+root: ${name}
+`),
+		"s.yml": []byte(`
+names:
+  - ${name}
+`),
+	})
+	env := func(key string) (string, error) {
+		if key == "name" {
+			return "ENV", nil
+		}
+		return "", ErrVarNotFound.New("%s not found", nil, key)
+	}
+	cases := []struct {
+		name     string
+		opts     []LoadOption
+		expected string
+	}{
+		{
+			name:     "global",
+			expected: `{"names":["api","web"],"root":"root"}`,
+		},
+		{
+			name:     "scoped",
+			opts:     []LoadOption{WithScopedVariables()},
+			expected: `{"names":["api","web"],"root":"root"}`,
+		},
+		{
+			name:     "env",
+			opts:     []LoadOption{WithVarResolver(env)},
+			expected: `{"names":["api","web"],"root":"ENV"}`,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var result map[string]any
+			err := Load("test.yml", &result, append([]LoadOption{WithFileSystem(fs)}, tt.opts...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bs, _ := json.Marshal(result)
+			if tt.expected != string(bs) {
+				t.Errorf("entry variables should take precedence: %s", string(bs))
+			}
+		})
+	}
+}
+
+func TestIncludeEntryError(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - path: child.yml
+      unknown: true
+`),
+		"path.yml": []byte(`
+_directives:
+  include:
+    - variables: {}
+`),
+		"docs.yml": []byte(`
+_directives:
+  include:
+    - multi.yml
+`),
+		"multi.yml": []byte(`
+a: 1
+---
+b: 1
+`),
+	})
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs))
+	if err == nil || "directive error: test.yml(line:5): unknown include property unknown: yammy error" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+	err = Load("path.yml", &result, WithFileSystem(fs))
+	if err == nil || "directive error: path.yml(line:4): path is required: yammy error" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+	err = Load("docs.yml", &result, WithFileSystem(fs))
+	if err == nil || "yaml error: multi.yml(line:4): included files must have a single document, "+
+		"but got 2 documents: yammy error" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+func TestOptionalInclude(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - base.yml
+    - path: local.yml
+      optional: true
+    - ?override.yml
+    - ?exists.yml
+name: test
+`),
+		"base.yml": []byte(`
+base: 1
+`),
+		"exists.yml": []byte(`
+exists: 1
+`),
+	})
+	type config struct {
+		SourceMap *SourceMap `yaml:"sourcemap"`
+		Name      string
+		Base      int
+		Exists    int
+	}
+	var result config
+	err := Load("test.yml", &result, WithFileSystem(fs), WithSourceMapKey("sourcemap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Name != "test" || result.Base != 1 || result.Exists != 1 {
+		t.Errorf("unexpected result: %#v", result)
+	}
+	if !reflect.DeepEqual([]string{"local.yml", "override.yml"}, result.SourceMap.Skipped) {
+		t.Errorf("skipped files should be recorded: %#v", result.SourceMap.Skipped)
+	}
+
+	fs = newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - path: local.yml
+      optional: yes please
+`),
+	})
+	err = Load("test.yml", &result, WithFileSystem(fs))
+	if err == nil || "directive error: test.yml(line:5): optional must be a boolean: yammy error" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+func TestIncludeAt(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - path: logging.yml
+      at: /services/api/logging
+    - path: logging.yml
+      at: /services/web~1v2/logging
+    - path: base.yml
+      at: /
+services:
+  api:
+    port: 8080
+    logging:
+      level: debug
+`),
+		"logging.yml": []byte(`
+level: info
+format: json
+`),
+		"base.yml": []byte(`
+name: test
+`),
+	})
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"name":"test","services":{"api":{"logging":{"format":"json","level":"debug"},"port":8080},` +
+		`"web/v2":{"logging":{"format":"json","level":"info"}}}}`
+	if expected != string(bs) {
+		t.Errorf("expected:\n--------------\n%s\n\nactual:\n---------------\n%s\n",
+			expected, string(bs))
+	}
+
+	fs = newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - path: logging.yml
+      at: services
+`),
+	})
+	err = Load("test.yml", &result, WithFileSystem(fs))
+	if err == nil || "directive error: test.yml(line:5): Invalid JSON Pointer: services: yammy error" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+
+	fs = newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - path: logging.yml
+      at: /services/0/logging
+services:
+  - name: api
+`),
+	})
+	err = Load("test.yml", &result, WithFileSystem(fs))
+	if err == nil || "directive error: test.yml(line:5): at can not contain sequence indices: /services/0: yammy error" !=
+		err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
@@ -2,6 +2,7 @@
 package yammy
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,7 +10,9 @@ import (
 	"io/fs"
 	"math"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -26,6 +29,18 @@ type loadConfig struct {
 	KeepsVariables       bool
 	RemovesBlockComments bool
 	JSONPatches          []map[string]any
+	MaxIncludeDepth      int
+	MergeStrategies      map[string]MergeStrategy
+	KeyOrder             KeyOrder
+	CollectsErrors       bool
+	VarNamespaces        map[string]VarResolver
+	DotEnvFiles          []string
+	Variables            map[string]string
+	VarPrecedence        []VarSource
+	EnvAllowlist         []string
+	ScopedVariables      bool
+	Profiles             []string
+	IncludeFetcher       IncludeFetcher
 }
 
 // LoadOption is an option for [Load] .
@@ -76,6 +91,98 @@ func WithVarResolver(v VarResolver) LoadOption {
 	}
 }
 
+// WithVarNamespace is an option that adds a variable namespace like '${prefix:KEY}' .
+// The resolver is called with the KEY. Built-in namespaces are:
+//
+//   - env: environment variables
+//   - var: variables that are defined in yammy directives
+//   - file: contents of files in the file system
+//
+// Namespaces that have the same prefix as built-in namespaces override them.
+func WithVarNamespace(prefix string, resolver VarResolver) LoadOption {
+	return func(c *loadConfig) {
+		if c.VarNamespaces == nil {
+			c.VarNamespaces = map[string]VarResolver{}
+		}
+		c.VarNamespaces[prefix] = resolver
+	}
+}
+
+// WithVariables is an option that specifies variables.
+// Variables specified by this option take precedence over any other variables.
+// Types of values are guessed like default values(i.e. '10' is a scalar number and '"10"' is a string).
+func WithVariables(vars map[string]string) LoadOption {
+	return func(c *loadConfig) {
+		if c.Variables == nil {
+			c.Variables = map[string]string{}
+		}
+		for k, v := range vars {
+			c.Variables[k] = v
+		}
+	}
+}
+
+// WithVarPrecedence is an option that specifies an order of variable sources.
+// Sources that are not specified are not used.
+// Variables specified by [WithVariables] always take precedence over these sources.
+// This defaults to [VarSourceEnv], [VarSourceDotEnv], [VarSourceDirective] .
+func WithVarPrecedence(sources ...VarSource) LoadOption {
+	return func(c *loadConfig) {
+		c.VarPrecedence = sources
+	}
+}
+
+// WithEnvAllowlist is an option that restricts environment variables
+// that can be used in files. Patterns are same as [path.Match] (i.e. 'APP_*').
+// Environment variables that do not match any patterns are treated as not defined.
+// This also applies to the 'env' namespace. The 'file' namespace is disabled because
+// files like '/proc/self/environ' have environment variables.
+// Note that this is not a sandbox: namespaces that are added by [WithVarNamespace]
+// and included files are not restricted.
+func WithEnvAllowlist(patterns ...string) LoadOption {
+	return func(c *loadConfig) {
+		c.EnvAllowlist = append(c.EnvAllowlist, patterns...)
+	}
+}
+
+// WithScopedVariables is an option that scopes variables per file.
+// Variables defined in a file are used in the file and its included files, and
+// variables in includers take precedence. Variables listed in '_directives.export'
+// are used in all files.
+func WithScopedVariables() LoadOption {
+	return func(c *loadConfig) {
+		c.ScopedVariables = true
+	}
+}
+
+// WithProfiles is an option that activates profiles defined in '_directives.profiles' .
+// Includes, patches and variables of the profiles are applied after the base document
+// in the given order. Profiles that are not defined in any files result in an error.
+func WithProfiles(names ...string) LoadOption {
+	return func(c *loadConfig) {
+		c.Profiles = append(c.Profiles, names...)
+	}
+}
+
+// WithIncludeFetcher is an option that allows including files that are specified
+// by URLs like 'https://example.com/base.yml' . Relative paths in the fetched files are
+// resolved against the URL. Include entries can pin contents with a checksum like
+// '{path: https://example.com/base.yml, checksum: "sha256:<hex>"}' .
+func WithIncludeFetcher(fetcher IncludeFetcher) LoadOption {
+	return func(c *loadConfig) {
+		c.IncludeFetcher = fetcher
+	}
+}
+
+// WithDotEnvFiles is an option that loads variables from dotenv files.
+// Values in the files override values in files that are listed in '_directives.envFiles' .
+// Environment variables take precedence over dotenv files.
+func WithDotEnvFiles(paths ...string) LoadOption {
+	return func(c *loadConfig) {
+		c.DotEnvFiles = append(c.DotEnvFiles, paths...)
+	}
+}
+
 // WithKeepsVariables is an option that keeps variables expression.
 func WithKeepsVariables() LoadOption {
 	return func(c *loadConfig) {
@@ -92,15 +199,58 @@ func WithRemovesBlockComments() LoadOption {
 
 // WithJSONPatches is an option that specifies JSON patches.
 // Arguments must be a slice of JSON patches.
-// In addition to the standard JSON patch properties(op, path, value),
-// 'source' property is also supported.
+// In addition to the standard JSON patch properties(op, path, from, value),
+// 'source' and 'when' properties are also supported.
 // 'source' will be used as a source map.
+// 'when' is a condition like 'when' of patches in '_directives.patches' .
 func WithJSONPatches(v []map[string]any) LoadOption {
 	return func(c *loadConfig) {
 		c.JSONPatches = v
 	}
 }
 
+// WithMergeStrategy is an option that specifies a strategy for merging
+// included nodes at the path.
+// path must be a JSON Pointer like '/spec/containers' .
+// Strategies specified by this option take precedence over strategies
+// defined in '_directives.merge' .
+func WithMergeStrategy(path string, strategy MergeStrategy) LoadOption {
+	return func(c *loadConfig) {
+		if c.MergeStrategies == nil {
+			c.MergeStrategies = map[string]MergeStrategy{}
+		}
+		c.MergeStrategies[path] = strategy
+	}
+}
+
+// WithKeyOrder is an option that specifies an order of mapping keys that
+// are added by merging and patching. Keys that are defined in a file
+// keep their order in the file.
+// This defaults to [KeyOrderSorted] .
+func WithKeyOrder(v KeyOrder) LoadOption {
+	return func(c *loadConfig) {
+		c.KeyOrder = v
+	}
+}
+
+// WithMaxIncludeDepth is an option that specifies a maximum depth of nested includes.
+// Load returns [ErrDirective] if included files are nested deeper than this.
+// This defaults to 0(that means unlimited).
+func WithMaxIncludeDepth(v int) LoadOption {
+	return func(c *loadConfig) {
+		c.MaxIncludeDepth = v
+	}
+}
+
+// WithErrorCollection is an option that keeps loading files after errors.
+// Failed patches, unresolved variables and invalid includes are skipped and
+// Load returns [Errors] that contains all of them.
+func WithErrorCollection() LoadOption {
+	return func(c *loadConfig) {
+		c.CollectsErrors = true
+	}
+}
+
 // WithEnvJSONPatches is an option that specifies JSON patches from environment variables.
 // WithEnvJSONPatches sorts environment variables by the name and parses them as JSON patches.
 //
@@ -118,8 +268,7 @@ func WithEnvJSONPatches(prefix string) LoadOption {
 	return WithJSONPatches(patches)
 }
 
-// Load loads given YAML/JON file.
-func Load(name string, dest any, opts ...LoadOption) error {
+func newLoadConfig(opts []LoadOption) (*loadConfig, error) {
 	c := &loadConfig{
 		FS:                   nil,
 		DirectiveKey:         "_directives",
@@ -128,35 +277,233 @@ func Load(name string, dest any, opts ...LoadOption) error {
 		VarResolver:          nil,
 		KeepsVariables:       false,
 		RemovesBlockComments: false,
+		MaxIncludeDepth:      0,
+		MergeStrategies:      nil,
+		KeyOrder:             KeyOrderSorted,
+		VarPrecedence:        defaultVarPrecedence,
 	}
 	for _, opt := range opts {
 		opt(c)
 	}
+	for path, strategy := range c.MergeStrategies {
+		if err := strategy.validate(); err != nil {
+			return nil, ErrDirective.New("%s: %s", nil, path, err.Error())
+		}
+	}
+	if err := c.KeyOrder.validate(); err != nil {
+		return nil, Err.New("%s", nil, err.Error())
+	}
+	if err := validateVarPrecedence(c.VarPrecedence); err != nil {
+		return nil, Err.New("%s", nil, err.Error())
+	}
+	for _, pattern := range c.EnvAllowlist {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, Err.New("invalid env allowlist pattern: %s", err, pattern)
+		}
+	}
+	return c, nil
+}
 
-	vNode := &yaml.Node{}
-	vNode.Kind = yaml.MappingNode
-	variables := newNode(vNode, name, c.RemovesBlockComments)
-	nd, err := loadNode(name, c, variables)
+// Load loads given YAML/JON file.
+// If the file contains multiple documents, Load loads the first document.
+// Use [LoadAll] to load all documents.
+func Load(name string, dest any, opts ...LoadOption) error {
+	c, err := newLoadConfig(opts)
 	if err != nil {
 		return err
 	}
-	nd.File = name
+	bs, err := readFile(name, c)
+	if err != nil {
+		return err
+	}
+	return load(name, bs, dest, c)
+}
 
-	varResolver := c.VarResolver
-	if varResolver == nil {
-		varResolver = newCompositeVarResolver(
-			envVarResolver,
-			newDirectiveVarResolver(variables))
-	} else {
-		varResolver = newCompositeVarResolver(
-			varResolver,
-			newDirectiveVarResolver(variables))
+// LoadBytes loads given YAML/JSON data like [Load] .
+// name is used as a file name in source maps and relative
+// included files are resolved from the directory of name.
+func LoadBytes(name string, data []byte, dest any, opts ...LoadOption) error {
+	c, err := newLoadConfig(opts)
+	if err != nil {
+		return err
+	}
+	return load(name, data, dest, c)
+}
+
+// LoadReader loads YAML/JSON data from given reader like [LoadBytes] .
+func LoadReader(name string, r io.Reader, dest any, opts ...LoadOption) error {
+	bs, err := io.ReadAll(r)
+	if err != nil {
+		return ErrIO.New("%s: failed to read given data", err, name).InFile(name)
+	}
+	return LoadBytes(name, bs, dest, opts...)
+}
+
+// LoadAll loads all documents in given YAML/JSON file.
+// dest must be a pointer to a slice. Each document is processed
+// independently and decoded into a new element of the slice.
+// Included files are loaded as single documents.
+func LoadAll(name string, dest any, opts ...LoadOption) error {
+	rv, err := sliceDest(dest)
+	if err != nil {
+		return err
+	}
+	c, err := newLoadConfig(opts)
+	if err != nil {
+		return err
+	}
+	bs, err := readFile(name, c)
+	if err != nil {
+		return err
+	}
+	return loadAll(name, bs, rv, c)
+}
+
+// LoadAllBytes loads all documents in given YAML/JSON data like [LoadAll] .
+// name is used like [LoadBytes] .
+func LoadAllBytes(name string, data []byte, dest any, opts ...LoadOption) error {
+	rv, err := sliceDest(dest)
+	if err != nil {
+		return err
+	}
+	c, err := newLoadConfig(opts)
+	if err != nil {
+		return err
 	}
+	return loadAll(name, data, rv, c)
+}
+
+// LoadAllReader loads all documents from given reader like [LoadAllBytes] .
+func LoadAllReader(name string, r io.Reader, dest any, opts ...LoadOption) error {
+	bs, err := io.ReadAll(r)
+	if err != nil {
+		return ErrIO.New("%s: failed to read given data", err, name).InFile(name)
+	}
+	return LoadAllBytes(name, bs, dest, opts...)
+}
 
-	err = processVars(nd, varResolver, c.KeepsVariables)
+func load(name string, bs []byte, dest any, c *loadConfig) error {
+	docs, err := parseDocuments(name, bs)
 	if err != nil {
 		return err
 	}
+	doc := &yaml.Node{}
+	if len(docs) != 0 {
+		doc = docs[0]
+	}
+	profiles := map[string]bool{}
+	nd, err := loadDocument(name, doc, c, profiles)
+	if err != nil {
+		return err
+	}
+	if err := checkProfiles(c, profiles); err != nil {
+		return err
+	}
+
+	if dest != nil {
+		err := nd.Decode(dest)
+		if err != nil {
+			return ErrYAML.New("%s: failed to map to given object", err, name).InFile(name)
+		}
+	}
+
+	return nil
+}
+
+func sliceDest(dest any) (reflect.Value, error) {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return rv, Err.New("dest must be a pointer to a slice, but got %T", nil, dest)
+	}
+	return rv, nil
+}
+
+func loadAll(name string, bs []byte, rv reflect.Value, c *loadConfig) error {
+	docs, err := parseDocuments(name, bs)
+	if err != nil {
+		return err
+	}
+
+	elemType := rv.Elem().Type().Elem()
+	values := reflect.MakeSlice(rv.Elem().Type(), 0, len(docs))
+	var errs Errors
+	profiles := map[string]bool{}
+	for i, doc := range docs {
+		nd, err := loadDocument(name, doc, c, profiles)
+		if err != nil {
+			if e, ok := err.(Errors); ok && c.CollectsErrors {
+				errs = append(errs, e...)
+				continue
+			}
+			return err
+		}
+		value := reflect.New(elemType)
+		if err := nd.Decode(value.Interface()); err != nil {
+			return ErrYAML.New("%s: failed to map document %d to given object", err, name, i).InFile(name)
+		}
+		values = reflect.Append(values, value.Elem())
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	if err := checkProfiles(c, profiles); err != nil {
+		return err
+	}
+	rv.Elem().Set(values)
+	return nil
+}
+
+// checkProfiles returns an error if one of active profiles is not defined.
+func checkProfiles(c *loadConfig, defined map[string]bool) error {
+	for _, name := range c.Profiles {
+		if !defined[name] {
+			return ErrDirective.New("profile %s is not defined", nil, name)
+		}
+	}
+	return nil
+}
+
+// loadDocument loads the document. Names of defined profiles are added to the profiles.
+func loadDocument(name string, doc *yaml.Node, c *loadConfig, profiles map[string]bool) (*node, error) {
+	vNode := &yaml.Node{}
+	vNode.Kind = yaml.MappingNode
+	variables := newNode(vNode, name, c.RemovesBlockComments)
+	ctx := &loadContext{
+		Variables:     variables,
+		IncludeChains: map[string][]string{},
+		MergeOptions: &mergeOptions{
+			Strategies: map[string]MergeStrategy{},
+			KeyOrder:   c.KeyOrder,
+		},
+		Errors:          &errorCollector{enabled: c.CollectsErrors},
+		DotEnv:          map[string]string{},
+		DotEnvOverrides: map[string]string{},
+		Profiles:        profiles,
+	}
+	for path, strategy := range c.MergeStrategies {
+		ctx.MergeOptions.Strategies[path] = strategy
+	}
+	for _, path := range c.DotEnvFiles {
+		values, err := readDotEnvFile(c, path)
+		if err = ctx.Errors.Collect(err); err != nil {
+			return nil, ctx.Errors.Err(err, ctx.IncludeChains)
+		}
+		for k, v := range values {
+			ctx.DotEnvOverrides[k] = v
+		}
+	}
+	nd, err := processDocument(name, doc, c, ctx, nil)
+	if err != nil {
+		return nil, ctx.Errors.Err(err, ctx.IncludeChains)
+	}
+	nd.File = name
+	nd.StripMergeTags()
+
+	vp := ctx.NewVarProcessor(c, nd, variables)
+	err = vp.Process(nd, "/")
+	if err != nil {
+		return nil, ctx.Errors.Err(err, ctx.IncludeChains)
+	}
 
 	if len(c.JSONPatches) != 0 {
 		var pNode yaml.Node
@@ -169,9 +516,15 @@ func Load(name string, dest any, opts ...LoadOption) error {
 			if source := pn.Get("source"); source != nil {
 				pn = newNode(pn.Node, source.Value, c.RemovesBlockComments)
 			}
-			err := processPatchNode(nd, pn)
-			if err != nil {
-				return err
+			ok, err := ctx.EvalCondition(c, pn.Get("when"), nil)
+			if err == nil && !ok {
+				continue
+			}
+			if err == nil {
+				err = processPatchNode(nd, pn, c.KeyOrder)
+			}
+			if err = ctx.Errors.Collect(err); err != nil {
+				return nil, err
 			}
 		}
 	}
@@ -179,126 +532,772 @@ func Load(name string, dest any, opts ...LoadOption) error {
 	if c.SourceMapComment {
 		nd.AddSourceComments()
 	}
-
-	if len(c.SourceMapKey) != 0 {
-		sm := nd.ToSourceMap("/")
-		var smNode yaml.Node
-		bs, _ := yaml.Marshal(sm)
-		_ = yaml.Unmarshal(bs, &smNode)
-		keyNode := newStringNode(c.SourceMapKey, nd.File)
-		nd.Put(keyNode, newNode(mustRootNode(&smNode), "", c.RemovesBlockComments))
+
+	if len(c.SourceMapKey) != 0 {
+		sm := nd.ToSourceMap("/")
+		sm.Skipped = ctx.Skipped
+		var smNode yaml.Node
+		bs, _ := yaml.Marshal(sm)
+		_ = yaml.Unmarshal(bs, &smNode)
+		keyNode := newStringNode(c.SourceMapKey, nd.File)
+		nd.PutWithOrder(keyNode, newNode(mustRootNode(&smNode), "", c.RemovesBlockComments), c.KeyOrder)
+	}
+
+	if err := ctx.Errors.Err(nil, ctx.IncludeChains); err != nil {
+		return nil, err
+	}
+	return nd, nil
+}
+
+func isEmptyDocument(doc *yaml.Node) bool {
+	if len(doc.Content) != 1 {
+		return len(doc.Content) == 0
+	}
+	root := doc.Content[0]
+	return root.Kind == yaml.ScalarNode && root.Tag == "!!null" && len(root.Value) == 0
+}
+
+func readFile(path string, c *loadConfig) ([]byte, error) {
+	fp, err := fsOpen(c.FS, path)
+	if err != nil {
+		return nil, ErrIO.New("%s: failed to load given file", err, path).InFile(path)
+	}
+	defer fp.Close()
+	bs, err := io.ReadAll(fp)
+	if err != nil {
+		return nil, ErrIO.New("%s: failed to load given file", err, path).InFile(path)
+	}
+	return bs, nil
+}
+
+func parseDocuments(path string, bs []byte) ([]*yaml.Node, error) {
+	var docs []*yaml.Node
+	decoder := yaml.NewDecoder(bytes.NewReader(bs))
+	for {
+		doc := &yaml.Node{}
+		err := decoder.Decode(doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, ErrYAML.New("%s: failed to parse given YAML file", err, path).InFile(path)
+		}
+		if isEmptyDocument(doc) {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	if len(docs) == 0 {
+		// an empty stream is an empty mapping
+		docs = append(docs, &yaml.Node{})
+	}
+	return docs, nil
+}
+
+// includeChain is a list of include entries that lead to a file.
+type includeChain []*node
+
+func (c includeChain) Contains(path string) bool {
+	path = filepath.Clean(path)
+	for _, entry := range c {
+		if filepath.Clean(entry.File) == path {
+			return true
+		}
+	}
+	return false
+}
+
+func (c includeChain) Files(path string) []string {
+	files := make([]string, 0, len(c)+1)
+	for _, entry := range c {
+		files = append(files, entry.File)
+	}
+	return append(files, path)
+}
+
+func (c includeChain) Format(path string) string {
+	parts := make([]string, 0, len(c)+1)
+	for _, entry := range c {
+		parts = append(parts, entry.Where())
+	}
+	parts = append(parts, path)
+	return strings.Join(parts, " -> ")
+}
+
+// loadContext is a state that is shared while loading files.
+type loadContext struct {
+	Variables       *node
+	MergeOptions    *mergeOptions
+	IncludeChains   map[string][]string
+	Errors          *errorCollector
+	DotEnv          map[string]string
+	DotEnvOverrides map[string]string
+	Profiles        map[string]bool
+	Scope           *varScope
+	Skipped         []string
+}
+
+// NewVarProcessor returns a varProcessor that resolves variables from
+// sources in the order of [WithVarPrecedence] .
+func (ctx *loadContext) NewVarProcessor(c *loadConfig, root *node, variables *node) *varProcessor {
+	dotEnvResolver := newCompositeVarResolver(
+		newDotEnvVarResolver(ctx.DotEnvOverrides), newDotEnvVarResolver(ctx.DotEnv))
+	var envResolver VarResolver = envVarResolver
+	if len(c.EnvAllowlist) != 0 {
+		envResolver = newAllowlistVarResolver(envResolver, c.EnvAllowlist)
+	}
+
+	vp := &varProcessor{
+		KeepsVariables: c.KeepsVariables,
+		Errors:         ctx.Errors,
+		Root:           root,
+		Variables:      variables,
+		Overrides:      c.Variables,
+		FS:             c.FS,
+		Fetcher:        c.IncludeFetcher,
+	}
+	directiveResolver := newDirectiveVarResolver(vp.FindVariable)
+
+	var resolvers []VarResolver
+	for _, source := range c.VarPrecedence {
+		switch source {
+		case VarSourceEnv:
+			if c.VarResolver != nil {
+				resolvers = append(resolvers, c.VarResolver)
+			} else {
+				resolvers = append(resolvers, envResolver)
+			}
+		case VarSourceDotEnv:
+			resolvers = append(resolvers, dotEnvResolver)
+		case VarSourceDirective:
+			resolvers = append(resolvers, directiveResolver)
+		}
+	}
+	vp.Resolver = newCompositeVarResolver(resolvers...)
+	fileResolver := vp.resolveFile
+	if len(c.EnvAllowlist) != 0 {
+		// files like '/proc/self/environ' have environment variables
+		fileResolver = func(key string) (string, error) {
+			return "", ErrDirective.New("%s: file namespace can not be used with WithEnvAllowlist", nil, key)
+		}
+	}
+	vp.Namespaces = map[string]VarResolver{
+		"env":  newCompositeVarResolver(envResolver, dotEnvResolver),
+		"var":  directiveResolver,
+		"file": fileResolver,
+	}
+	for prefix, resolver := range c.VarNamespaces {
+		vp.Namespaces[prefix] = resolver
+	}
+	return vp
+}
+
+// ExportVariables adds variables that are listed in the exports to global variables.
+func (ctx *loadContext) ExportVariables(scope *varScope, exports *node) error {
+	if exports == nil {
+		return nil
+	}
+	if exports.Kind != yaml.SequenceNode {
+		return ErrDirective.New("%s: export must be a sequence node", nil, exports.Where()).At(exports)
+	}
+	exported := newMappingNode(exports.File)
+	for _, name := range exports.Content {
+		v := scope.Get(name.Value)
+		if v == nil {
+			return ErrDirective.New("%s: exported variable %s is not defined", nil,
+				name.Where(), name.Value).At(name)
+		}
+		exported.Put(newStringNode(name.Value, name.File), v)
+	}
+	_, err := ctx.Variables.Merge(exported, nil)
+	return err
+}
+
+// LoadInstance loads the included file. If the include entry has variables,
+// the variables are used in the loaded nodes and take precedence over
+// variables defined in the included files.
+func (ctx *loadContext) LoadInstance(file includeFile, c *loadConfig, chain includeChain) (*node, error) {
+	if file.Entry.Variables == nil {
+		return loadIncludeFile(file, c, ctx, chain)
+	}
+	parent := ctx.Scope
+	scope := &varScope{Variables: file.Entry.Variables, Parent: parent, Entry: true}
+	ctx.Scope = scope
+	defer func() {
+		ctx.Scope = parent
+	}()
+	include, err := loadIncludeFile(file, c, ctx, chain)
+	if err != nil {
+		return nil, err
+	}
+	include.SetScope(scope, false)
+	return include, nil
+}
+
+// EvalCondition evaluates the 'when' condition of include and patch entries.
+// Conditions are evaluated with variables that are available at this time:
+// variables defined in the file, variables passed by include entries and
+// variables defined in already loaded files.
+func (ctx *loadContext) EvalCondition(c *loadConfig, when *node, variables *node) (bool, error) {
+	if when == nil {
+		return true, nil
+	}
+	if when.Kind != yaml.ScalarNode {
+		return false, ErrDirective.New("%s: when must be a string", nil, when.Where()).At(when)
+	}
+	expr, err := parseCondition(when.Value)
+	if err != nil {
+		return false, ErrDirective.New("%s: invalid condition: %s", nil, when.Where(), err.Error()).At(when)
+	}
+	scope := ctx.Scope
+	if !c.ScopedVariables {
+		scope = &varScope{Variables: variables, Parent: ctx.Scope}
+	}
+	vp := ctx.NewVarProcessor(c, nil, ctx.Variables)
+	vp.Scope = scope
+	ok, err := expr.Eval(condLookup{vp})
+	if _, isWrapped := err.(*wrappedError); err != nil && !isWrapped {
+		err = ErrDirective.New("%s: %s", nil, when.Where(), err.Error())
+	}
+	return ok, errorAt(err, when, "")
+}
+
+// varScope is a scope of variables that are defined in a file or an include entry.
+type varScope struct {
+	Variables *node
+	Parent    *varScope
+	// Entry is true if the Variables are given by an include entry.
+	Entry bool
+}
+
+// Get finds a variable named key. Variables in includers take precedence, but
+// variables of include entries take precedence over variables of the includers.
+func (s *varScope) Get(key string) *node {
+	return s.find(key, false)
+}
+
+// EntryGet finds a variable named key in variables of include entries.
+func (s *varScope) EntryGet(key string) *node {
+	return s.find(key, true)
+}
+
+func (s *varScope) find(key string, entryOnly bool) *node {
+	if s == nil {
+		return nil
+	}
+	var own *node
+	if s.Variables != nil && s.Variables.Kind == yaml.MappingNode && (s.Entry || !entryOnly) {
+		own = s.Variables.Get(key)
+	}
+	if s.Entry && own != nil {
+		return own
+	}
+	if v := s.Parent.find(key, entryOnly); v != nil {
+		return v
+	}
+	return own
+}
+
+// AddDotEnv adds the dotenv values. The values override loaded values.
+func (ctx *loadContext) AddDotEnv(values map[string]string) {
+	for k, v := range values {
+		ctx.DotEnv[k] = v
+	}
+}
+
+func readDotEnvFile(c *loadConfig, path string) (map[string]string, error) {
+	var bs []byte
+	var err error
+	if isURL(path) {
+		bs, err = fetchInclude(c, path, "")
+		if err != nil {
+			err = ErrIO.New("%s: failed to load given file", err, path).InFile(path)
+		}
+	} else {
+		bs, err = readFile(path, c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseDotEnv(path, bs)
+}
+
+func (ctx *loadContext) AddMergeStrategies(c *loadConfig, strategies *node) error {
+	if strategies.Kind != yaml.MappingNode {
+		return ErrDirective.New("%s: merge must be a mapping node", nil, strategies.Where()).At(strategies)
+	}
+	return strategies.ForEachMap(func(k, v *node) error {
+		if _, err := parseJSONPointer(k.Value); err != nil {
+			return ErrDirective.New("%s: %s", nil, k.Where(), err.Error()).At(k)
+		}
+		strategy, err := parseMergeStrategy(v)
+		if err != nil {
+			return ErrDirective.New("%s: %s", nil, v.Where(), err.Error()).At(v).WithPath(k.Value)
+		}
+		if _, ok := c.MergeStrategies[k.Value]; !ok {
+			ctx.MergeOptions.Strategies[k.Value] = strategy
+		}
+		return nil
+	})
+}
+
+type includeFile struct {
+	Path  string
+	Entry *includeEntry
+	// Data is contents of the file if the file is fetched by an [IncludeFetcher] .
+	Data []byte
+}
+
+// includeEntry is an entry of '_directives.include' .
+// An entry is a path string or a mapping like '{path: a.yml, variables: {name: a}}' .
+type includeEntry struct {
+	*node
+	Path      string
+	Variables *node
+	Optional  bool
+	At        jsonPointer
+	When      *node
+	Checksum  string
+}
+
+// Mount wraps the included node with mapping nodes so that the node
+// is placed at the JSON Pointer specified by 'at' .
+func (e *includeEntry) Mount(include *node) *node {
+	for i := len(e.At) - 1; i >= 0; i-- {
+		parent := newMappingNode(e.File)
+		parent.Line = e.Line
+		parent.Column = e.Column
+		key := newStringNode(e.At[i].String, e.File)
+		key.Line = e.Line
+		key.Column = e.Column
+		parent.Put(key, include)
+		include = parent
+	}
+	return include
+}
+
+func parseIncludeEntry(n *node) (*includeEntry, error) {
+	entry := &includeEntry{node: n}
+	switch n.Kind {
+	case yaml.ScalarNode:
+		entry.Path = n.Value
+	case yaml.MappingNode:
+	default:
+		return nil, ErrDirective.New("%s: include entry must be a string or a mapping node", nil, n.Where()).At(n)
+	}
+	err := n.ForEachMap(func(k, v *node) error {
+		switch k.Value {
+		case "path":
+			if v.Kind != yaml.ScalarNode {
+				return ErrDirective.New("%s: path must be a string", nil, v.Where()).At(v)
+			}
+			entry.Path = v.Value
+		case "variables":
+			if v.Kind != yaml.MappingNode {
+				return ErrDirective.New("%s: variables must be a mapping node", nil, v.Where()).At(v)
+			}
+			entry.Variables = v
+		case "optional":
+			if v.Kind != yaml.ScalarNode || v.Tag != "!!bool" {
+				return ErrDirective.New("%s: optional must be a boolean", nil, v.Where()).At(v)
+			}
+			entry.Optional = v.Value == "true"
+		case "at":
+			if v.Kind != yaml.ScalarNode {
+				return ErrDirective.New("%s: at must be a string", nil, v.Where()).At(v)
+			}
+			if v.Value == "/" {
+				return nil
+			}
+			jp, err := parseJSONPointer(v.Value)
+			if err != nil {
+				return ErrDirective.New("%s: %s", nil, v.Where(), err.Error()).At(v)
+			}
+			for _, t := range jp {
+				if t.IsIndex {
+					return ErrDirective.New("%s: at can not contain sequence indices: %s",
+						nil, v.Where(), t.Path).At(v)
+				}
+			}
+			entry.At = jp
+		case "when":
+			entry.When = v
+		case "checksum":
+			sum, err := parseChecksum(v.Value)
+			if err != nil || v.Kind != yaml.ScalarNode {
+				return ErrDirective.New("%s: invalid checksum %s", nil, v.Where(), v.Value).At(v)
+			}
+			entry.Checksum = sum
+		default:
+			return ErrDirective.New("%s: unknown include property %s", nil, k.Where(), k.Value).At(k)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(entry.Path) == 0 {
+		return nil, ErrDirective.New("%s: path is required", nil, n.Where()).At(n)
 	}
+	if strings.HasPrefix(entry.Path, "?") {
+		entry.Optional = true
+		entry.Path = entry.Path[1:]
+	}
+	return entry, nil
+}
 
-	if dest != nil {
-		err := nd.Decode(dest)
+// loadIncludeFile loads the included file. Contents of the file are verified
+// if the include entry has a checksum.
+func loadIncludeFile(file includeFile, c *loadConfig, ctx *loadContext, chain includeChain) (*node, error) {
+	bs := file.Data
+	if !isURL(file.Path) {
+		var err error
+		bs, err = readFile(file.Path, c)
 		if err != nil {
-			return ErrYAML.New("%s: failed to map to given object", err, name)
+			return nil, err
 		}
 	}
-
-	return nil
+	if len(file.Entry.Checksum) != 0 {
+		if sum := sha256Hex(bs); sum != file.Entry.Checksum {
+			return nil, ErrDirective.New("%s: checksum mismatch for %s(expected sha256:%s, but got sha256:%s)", nil,
+				file.Entry.Where(), file.Path, file.Entry.Checksum, sum).At(file.Entry.node)
+		}
+	}
+	return loadNode(file.Path, bs, c, ctx, chain)
 }
 
-func loadNode(path string, c *loadConfig, allVariables *node) (*node, error) {
-	fp, err := fsOpen(c.FS, path)
+func loadNode(path string, bs []byte, c *loadConfig, ctx *loadContext, chain includeChain) (*node, error) {
+	docs, err := parseDocuments(path, bs)
 	if err != nil {
-		return nil, ErrIO.New("%s: failed to load given file", err, path)
+		return nil, err
 	}
-	bs, err := io.ReadAll(fp)
-	if err != nil {
-		return nil, ErrIO.New("%s: failed to load given file", err, path)
+	if len(docs) > 1 {
+		second := newNode(mustRootNode(docs[1]), path, false)
+		return nil, ErrYAML.New("%s: included files must have a single document, but got %d documents",
+			nil, second.Where(), len(docs)).At(second)
 	}
+	return processDocument(path, docs[0], c, ctx, chain)
+}
 
-	var docv yaml.Node
-	doc := &docv
-	err = yaml.Unmarshal(bs, doc)
-	if err != nil {
-		return nil, ErrYAML.New("%s: failed to parse given YAML file", err, path)
+func processDocument(path string, doc *yaml.Node, c *loadConfig, ctx *loadContext,
+	chain includeChain) (*node, error) {
+	if _, ok := ctx.IncludeChains[path]; !ok {
+		ctx.IncludeChains[path] = chain.Files(path)
 	}
-
 	rootNode := mustRootNode(doc)
 	root := newNode(rootNode, path, c.RemovesBlockComments)
 	if rootNode.Kind != yaml.MappingNode {
-		return nil, ErrYAML.New("%s: root node must be a mapping node(%s)", nil, path, root.KindString())
+		return nil, ErrYAML.New("%s: root node must be a mapping node(%s)", nil, path, root.KindString()).At(root)
 	}
 	directives := root.Get(c.DirectiveKey)
-	var includes, patches, variables *node
+	var includes, patches, mergePatch, variables, strategies, envFiles, exports, profileNodes *node
 	if directives != nil {
 		root.Delete(c.DirectiveKey)
 		if directives.Kind != yaml.MappingNode {
-			return nil, ErrYAML.New("%s: %s must be a mapping node", nil, path, c.DirectiveKey)
+			return nil, ErrYAML.New("%s: %s must be a mapping node", nil, path, c.DirectiveKey).At(directives)
 		}
 		includes = directives.Get("include")
 		patches = directives.Get("patches")
+		mergePatch = directives.Get("mergePatch")
 		variables = directives.Get("variables")
+		strategies = directives.Get("merge")
+		envFiles = directives.Get("envFiles")
+		exports = directives.Get("export")
+		profileNodes = directives.Get("profiles")
 	}
 
-	var files []string
-	if includes != nil {
-		for _, includeNode := range includes.Content {
-			include := includeNode.Value
-			fullPath := include
-			if !filepath.IsAbs(fullPath) {
-				fullPath = filepath.Join(filepath.Dir(path), include)
-			}
-			paths, err := fsGlob(c.FS, fullPath)
-			if err != nil {
-				return nil, ErrIO.New("%s: failed to find a included file %s", err, path, include)
-			}
-			if len(paths) == 0 {
-				return nil, ErrIO.New("%s: failed to find a included file %s", nil, path, include)
-			}
-			files = append(files, paths...)
+	profiles, err := ctx.ActivateProfiles(c, profileNodes)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range profiles {
+		if p.Variables == nil {
+			continue
+		}
+		if variables == nil {
+			variables = p.Variables
+			continue
+		}
+		if variables, err = variables.Clone().Merge(p.Variables, nil); err != nil {
+			return nil, err
 		}
 	}
 
-	var mergedNode *node
+	var scope *varScope
+	if c.ScopedVariables {
+		parent := ctx.Scope
+		scope = &varScope{Variables: variables, Parent: parent}
+		ctx.Scope = scope
+		defer func() {
+			ctx.Scope = parent
+		}()
+	}
 
-	for _, file := range files {
-		include, err := loadNode(file, c, allVariables)
-		if err != nil {
+	if strategies != nil {
+		if err := ctx.AddMergeStrategies(c, strategies); err != nil {
 			return nil, err
 		}
-		if mergedNode == nil {
-			mergedNode = include
-			continue
+	}
+
+	// dotenv values are loaded before includes to be used in conditions
+	dotEnv := map[string]string{}
+	if envFiles != nil {
+		if envFiles.Kind != yaml.SequenceNode {
+			return nil, ErrDirective.New("%s: envFiles must be a sequence node", nil, envFiles.Where()).At(envFiles)
 		}
-		mergedNode, err = mergedNode.Merge(include)
-		if err != nil {
-			return nil, err
+		for _, envFile := range envFiles.Content {
+			envPath, err := resolvePath(path, envFile.Value)
+			var values map[string]string
+			if err == nil {
+				values, err = readDotEnvFile(c, envPath)
+			} else {
+				err = ErrDirective.New("%s: %s", nil, envFile.Where(), err.Error())
+			}
+			if err := ctx.Errors.Collect(errorAt(err, envFile, "")); err != nil {
+				return nil, err
+			}
+			for k, v := range values {
+				dotEnv[k] = v
+			}
 		}
 	}
+	ctx.AddDotEnv(dotEnv)
+
+	mergedNode, err := loadIncludes(path, includes, variables, c, ctx, chain)
+	if err != nil {
+		return nil, err
+	}
 	if mergedNode == nil {
 		mergedNode = root
 	} else {
-		mergedNode, err = mergedNode.Merge(root)
+		mergedNode, err = mergedNode.Merge(root, ctx.MergeOptions)
 	}
 	if err != nil {
 		return nil, err
 	}
 
-	err = processPatchNodes(mergedNode, patches)
+	if mergePatch != nil {
+		if mergePatch.Kind != yaml.MappingNode {
+			err = ErrDirective.New("%s: mergePatch must be a mapping node", nil, mergePatch.Where()).At(mergePatch)
+			if err = ctx.Errors.Collect(err); err != nil {
+				return nil, err
+			}
+		} else {
+			mergedNode = mergedNode.MergePatch(mergePatch, ctx.MergeOptions.Order())
+		}
+	}
+
+	patchCondition := func(patchNode *node) (bool, error) {
+		if patchNode.Kind != yaml.MappingNode {
+			return true, nil
+		}
+		return ctx.EvalCondition(c, patchNode.Get("when"), variables)
+	}
+	err = processPatchNodes(mergedNode, patches, ctx.MergeOptions.Order(), ctx.Errors, patchCondition)
 	if err != nil {
 		return nil, err
 	}
 
-	if variables != nil {
-		_, err = allVariables.Merge(variables)
+	for _, p := range profiles {
+		include, err := loadIncludes(path, p.Includes, variables, c, ctx, chain)
+		if err != nil {
+			return nil, err
+		}
+		if include != nil {
+			if mergedNode, err = mergedNode.Merge(include, ctx.MergeOptions); err != nil {
+				return nil, err
+			}
+		}
+		err = processPatchNodes(mergedNode, p.Patches, ctx.MergeOptions.Order(), ctx.Errors, patchCondition)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if scope != nil {
+		if err := ctx.ExportVariables(scope, exports); err != nil {
+			return nil, err
+		}
+		mergedNode.SetScope(scope, false)
+	} else if variables != nil {
+		_, err = ctx.Variables.Merge(variables, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// values in the file override values in included files
+	ctx.AddDotEnv(dotEnv)
+
+	return mergedNode, nil
+}
+
+// profile is an entry of '_directives.profiles' .
+// A profile has extra includes, patches and variables that are applied after the base document.
+type profile struct {
+	Includes  *node
+	Patches   *node
+	Variables *node
+}
+
+// ActivateProfiles returns active profiles that are defined in the profiles in the order of [WithProfiles] .
+func (ctx *loadContext) ActivateProfiles(c *loadConfig, profiles *node) ([]*profile, error) {
+	if profiles == nil {
+		return nil, nil
+	}
+	if profiles.Kind != yaml.MappingNode {
+		return nil, ErrDirective.New("%s: profiles must be a mapping node", nil, profiles.Where()).At(profiles)
+	}
+	var ret []*profile
+	for _, name := range c.Profiles {
+		v := profiles.Get(name)
+		if v == nil {
+			continue
+		}
+		ctx.Profiles[name] = true
+		if v.Kind != yaml.MappingNode {
+			return nil, ErrDirective.New("%s: profile %s must be a mapping node", nil, v.Where(), name).At(v)
+		}
+		p := &profile{}
+		err := v.ForEachMap(func(k, v *node) error {
+			switch k.Value {
+			case "include":
+				p.Includes = v
+			case "patches":
+				p.Patches = v
+			case "variables":
+				if v.Kind != yaml.MappingNode {
+					return ErrDirective.New("%s: variables must be a mapping node", nil, v.Where()).At(v)
+				}
+				p.Variables = v
+			default:
+				return ErrDirective.New("%s: unknown profile property %s", nil, k.Where(), k.Value).At(k)
+			}
+			return nil
+		})
 		if err != nil {
 			return nil, err
 		}
+		ret = append(ret, p)
+	}
+	return ret, nil
+}
+
+// fetchInclude fetches the url with the [IncludeFetcher] .
+// sum is a sha256 checksum that pins contents of the url, or an empty string.
+func fetchInclude(c *loadConfig, u, sum string) ([]byte, error) {
+	if c.IncludeFetcher == nil {
+		return nil, fmt.Errorf("WithIncludeFetcher is required to include URLs")
+	}
+	if f, ok := c.IncludeFetcher.(PinnedIncludeFetcher); ok && len(sum) != 0 {
+		return f.FetchPinned(u, sum)
+	}
+	return c.IncludeFetcher.Fetch(u)
+}
+
+// loadIncludes loads files that are listed in the includes and merges them.
+// loadIncludes returns nil if no files are included.
+func loadIncludes(path string, includes, variables *node, c *loadConfig, ctx *loadContext,
+	chain includeChain) (*node, error) {
+	var files []includeFile
+	if includes != nil {
+		for _, includeNode := range includes.Content {
+			entry, err := parseIncludeEntry(includeNode)
+			if err != nil {
+				if err = ctx.Errors.Collect(err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			ok, err := ctx.EvalCondition(c, entry.When, variables)
+			if err == nil && !ok {
+				continue
+			}
+			if err != nil {
+				if err = ctx.Errors.Collect(err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			include := entry.Path
+			fullPath, err := resolvePath(path, include)
+			var paths []string
+			var data []byte
+			if err == nil && isURL(fullPath) {
+				paths = []string{fullPath}
+				data, err = fetchInclude(c, fullPath, entry.Checksum)
+			} else if err == nil {
+				paths, err = fsGlob(c.FS, fullPath)
+				if err == nil && len(paths) == 0 {
+					err = fs.ErrNotExist
+				}
+			}
+			if entry.Optional && errors.Is(err, fs.ErrNotExist) {
+				ctx.Skipped = append(ctx.Skipped, fullPath)
+				continue
+			}
+			if err != nil {
+				err = ErrIO.New("%s: failed to find a included file %s", err, path, include).At(includeNode)
+				if err = ctx.Errors.Collect(err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			for _, p := range paths {
+				files = append(files, includeFile{Path: p, Entry: entry, Data: data})
+			}
+		}
 	}
 
+	var mergedNode *node
+	for _, file := range files {
+		fileChain := append(append(includeChain{}, chain...), file.Entry.node)
+		var include *node
+		var err error
+		if fileChain.Contains(file.Path) {
+			err = ErrIncludeCycle.New("%s", nil, fileChain.Format(file.Path)).At(file.Entry.node)
+		} else if c.MaxIncludeDepth > 0 && len(fileChain) > c.MaxIncludeDepth {
+			err = ErrDirective.New("%s: include depth exceeds %d: %s", nil,
+				file.Entry.Where(), c.MaxIncludeDepth, fileChain.Format(file.Path)).At(file.Entry.node)
+		} else {
+			include, err = ctx.LoadInstance(file, c, fileChain)
+			if err == nil {
+				include = file.Entry.Mount(include)
+			}
+		}
+		if err != nil {
+			if err = ctx.Errors.Collect(err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if mergedNode == nil {
+			mergedNode = include
+			continue
+		}
+		mergedNode, err = mergedNode.Merge(include, ctx.MergeOptions)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return mergedNode, nil
 }
 
-func processPatchNodes(n *node, patchNodes *node) error {
+func processPatchNodes(n *node, patchNodes *node, order KeyOrder, errs *errorCollector,
+	when func(patchNode *node) (bool, error)) error {
 	if patchNodes == nil {
 		return nil
 	}
 
 	for _, patchNode := range patchNodes.Content {
-		err := processPatchNode(n, patchNode)
+		ok, err := when(patchNode)
+		if err == nil && !ok {
+			continue
+		}
+		if err == nil {
+			err = processPatchNode(n, patchNode, order)
+		}
+		err = errs.Collect(err)
 		if err != nil {
 			return err
 		}
@@ -307,10 +1306,18 @@ func processPatchNodes(n *node, patchNodes *node) error {
 	return nil
 }
 
-func processPatchNode(n *node, patchNode *node) error {
+func processPatchNode(n *node, patchNode *node, order KeyOrder) error {
 	if patchNode == nil {
 		return nil
 	}
+	path := ""
+	if pn := patchNode.Get("path"); pn != nil {
+		path = pn.Value
+	}
+	return errorAt(applyPatchNode(n, patchNode, order), patchNode, path)
+}
+
+func applyPatchNode(n *node, patchNode *node, order KeyOrder) error {
 
 	if patchNode.Kind != yaml.MappingNode {
 		return ErrDirective.New("%s: invalid patch", nil, patchNode.Where())
@@ -330,7 +1337,7 @@ func processPatchNode(n *node, patchNode *node) error {
 
 	newValue := patchNode.Get("value")
 	if op == "add" {
-		if err := jsonPatchAdd(n, jp, newValue); err != nil {
+		if err := jsonPatchAdd(n, jp, newValue, order); err != nil {
 			return ErrDirective.New("%s: %s", nil, patchNode.Where(), err.Error())
 		}
 		return nil
@@ -342,8 +1349,38 @@ func processPatchNode(n *node, patchNode *node) error {
 		return nil
 	}
 	if op == "replace" {
+		// keys are re-inserted at sorted positions only in the default order
+		if order != KeyOrderSorted && jsonPatchReplaceInPlace(n, jp, newValue) {
+			return nil
+		}
 		_ = jsonPatchRemove(n, jp)
-		if err := jsonPatchAdd(n, jp, newValue); err != nil && !errors.Is(err, errNotFound) {
+		if err := jsonPatchAdd(n, jp, newValue, order); err != nil && !errors.Is(err, errNotFound) {
+			return ErrDirective.New("%s: %s", nil, patchNode.Where(), err.Error())
+		}
+		return nil
+	}
+	if op == "move" || op == "copy" {
+		fn := patchNode.Get("from")
+		if fn == nil {
+			return ErrDirective.New(
+				"%s: invalid patch(from is required for a %s operation)", nil, patchNode.Where(), op)
+		}
+		from, err := parseJSONPointer(fn.Value)
+		if err != nil {
+			return ErrDirective.New("%s: %s", nil, patchNode.Where(), err.Error())
+		}
+		if op == "move" {
+			err = jsonPatchMove(n, from, jp, order)
+		} else {
+			err = jsonPatchCopy(n, from, jp, order)
+		}
+		if err != nil {
+			return ErrDirective.New("%s: %s", nil, patchNode.Where(), err.Error())
+		}
+		return nil
+	}
+	if op == "test" {
+		if err := jsonPatchTest(n, jp, newValue); err != nil {
 			return ErrDirective.New("%s: %s", nil, patchNode.Where(), err.Error())
 		}
 		return nil
@@ -353,12 +1390,61 @@ func processPatchNode(n *node, patchNode *node) error {
 		"%s: unsupported patch operation: %s", nil, patchNode.Where(), op)
 }
 
-func jsonPatchAdd(n *node, jp jsonPointer, newValue *node) error {
+func jsonPatchMove(n *node, from, to jsonPointer, order KeyOrder) error {
+	if from.String() == to.String() {
+		return nil
+	}
+	if strings.HasPrefix(to.String(), from.String()+"/") {
+		return fmt.Errorf("can not move a value %s into its children %s", from.String(), to.String())
+	}
+	value, err := n.FindNodeByJSONPointer(from.String())
+	if err != nil {
+		return err
+	}
+	if err := jsonPatchRemove(n, from); err != nil {
+		return err
+	}
+	return jsonPatchAdd(n, to, value, order)
+}
+
+func jsonPatchCopy(n *node, from, to jsonPointer, order KeyOrder) error {
+	value, err := n.FindNodeByJSONPointer(from.String())
+	if err != nil {
+		return err
+	}
+	return jsonPatchAdd(n, to, value.Clone(), order)
+}
+
+func jsonPatchTest(n *node, jp jsonPointer, expected *node) error {
+	if expected == nil {
+		return fmt.Errorf("value is required for a test operation")
+	}
+	value, err := n.FindNodeByJSONPointer(jp.String())
+	if err != nil {
+		return err
+	}
+	if !value.Equal(expected) {
+		return fmt.Errorf("test failed: %s is not equal to the expected value", jp.String())
+	}
+	return nil
+}
+
+func jsonPatchReplaceInPlace(n *node, jp jsonPointer, newValue *node) bool {
+	parent, child := jp.Pop()
+	target, err := n.FindNodeByJSONPointer(parent.String())
+	if err != nil || newValue == nil || target.Kind != yaml.MappingNode || target.Get(child.String) == nil {
+		return false
+	}
+	target.Put(newStringNode(child.String, n.File), newValue)
+	return true
+}
+
+func jsonPatchAdd(n *node, jp jsonPointer, newValue *node, order KeyOrder) error {
 	parent, child := jp.Pop()
 	target, err := n.FindNodeByJSONPointer(parent.String())
 
 	if errors.Is(err, errNotFound) {
-		err = ensureJSONPointerParent(n, jp)
+		err = ensureJSONPointerParent(n, jp, order)
 		if err != nil {
 			return err
 		}
@@ -383,14 +1469,14 @@ func jsonPatchAdd(n *node, jp jsonPointer, newValue *node) error {
 	}
 	if target.Kind == yaml.MappingNode {
 		key := newStringNode(child.String, n.File)
-		target.Put(key, newValue)
+		target.PutWithOrder(key, newValue, order)
 		return nil
 	}
 	return fmt.Errorf("can not perform an add '%s' key operation on (an) %s node(path: %s)",
 		child.Original, target.KindString(), parent.String())
 }
 
-func ensureJSONPointerParent(obj *node, pointer jsonPointer) error {
+func ensureJSONPointerParent(obj *node, pointer jsonPointer, order KeyOrder) error {
 	parent := obj
 	for i := 0; i < len(pointer)-1; i++ {
 		t := pointer[i]
@@ -414,9 +1500,9 @@ func ensureJSONPointerParent(obj *node, pointer jsonPointer) error {
 			key := newStringNode(t.String, parent.File)
 			if v := parent.Get(t.String); v == nil {
 				if n.IsIndex {
-					parent.Put(key, newSequenceNode(parent.File))
+					parent.PutWithOrder(key, newSequenceNode(parent.File), order)
 				} else {
-					parent.Put(key, newMappingNode(parent.File))
+					parent.PutWithOrder(key, newMappingNode(parent.File), order)
 				}
 			}
 			parent = parent.Get(t.String)
@@ -453,38 +1539,234 @@ func jsonPatchRemove(n *node, jp jsonPointer) error {
 		target.KindString(), parent.String())
 }
 
-func processVars(n *node, resolver VarResolver, keepsVariables bool) error {
+// varProcessor expands variables in nodes.
+// References like '${/a/b}' are resolved against the Root in dependency order.
+// Scalars like '${name}' are replaced with non-scalar nodes in the Variables.
+type varProcessor struct {
+	Resolver       VarResolver
+	KeepsVariables bool
+	Errors         *errorCollector
+	Root           *node
+	Variables      *node
+	Namespaces     map[string]VarResolver
+	Overrides      map[string]string
+	FS             fs.FS
+	Fetcher        IncludeFetcher
+	// Scope is used to find variables if no nodes are being processed.
+	Scope *varScope
+
+	processed map[*node]bool
+	resolving []*node
+	paths     []string
+	expanding []string
+}
 
+func (p *varProcessor) Process(n *node, path string) error {
 	switch n.Kind {
 	case yaml.MappingNode:
-		return n.ForEachMap(func(_, v *node) error {
-			return processVars(v, resolver, keepsVariables)
+		return n.ForEachMap(func(k, v *node) error {
+			return p.Process(v, mustJSONPointer(path, k.Value))
 		})
 	case yaml.SequenceNode:
-		return n.ForEachSeq(func(_ int, v *node) error {
-			return processVars(v, resolver, keepsVariables)
+		return n.ForEachSeq(func(i int, v *node) error {
+			return p.Process(v, mustJSONPointer(path, i))
 		})
 	case yaml.ScalarNode:
-		if n.Tag == "!!str" {
-			newString, err := expandVar(n.Value, resolver, keepsVariables)
-			if err != nil {
-				return err
-			}
-			if n.Value != newString {
-				var d yaml.Node
-				err := yaml.Unmarshal([]byte(newString), &d)
-				if err != nil {
-					return ErrYAML.New("%s: failed to parse a variable", err, n.Where())
-				}
-				nd := mustRootNode(&d)
-				n.SetString(nd.Value)
-				n.Tag = nd.Tag
+		return p.Errors.Collect(p.processScalar(n, path))
+	}
+	return nil
+}
+
+func (p *varProcessor) processScalar(n *node, path string) error {
+	if n.Tag != "!!str" || p.processed[n] {
+		return nil
+	}
+	if p.processed == nil {
+		p.processed = map[*node]bool{}
+	}
+	p.processed[n] = true
+	p.resolving = append(p.resolving, n)
+	p.paths = append(p.paths, path)
+	defer func() {
+		p.resolving = p.resolving[:len(p.resolving)-1]
+		p.paths = p.paths[:len(p.paths)-1]
+	}()
+	if name, ok := singleVarName(n.Value); ok {
+		if replaced, err := p.replaceNode(n, name, path); replaced || err != nil {
+			return err
+		}
+	}
+
+	newString, err := expandVar(n.Value, p, p.KeepsVariables, n.Where()+": "+path)
+	if err != nil {
+		return errorAt(err, n, path)
+	}
+	if n.Value != newString {
+		var d yaml.Node
+		err := yaml.Unmarshal([]byte(newString), &d)
+		if err != nil {
+			return ErrYAML.New("%s: failed to parse a variable", err, n.Where()).At(n).WithPath(path)
+		}
+		nd := mustRootNode(&d)
+		if nd.Kind != yaml.ScalarNode {
+			nd.Style = 0
+			nd.Line, nd.Column = n.Line, n.Column
+			for _, c := range nd.Content {
+				c.Line, c.Column = n.Line, n.Column
 			}
+			scope := n.Scope
+			*n = *newNode(nd, n.File, false)
+			n.SetScope(scope, true)
+			return nil
 		}
+		n.SetString(nd.Value)
+		n.Tag = nd.Tag
 	}
 	return nil
 }
 
+// replaceNode replaces n with a clone of a non-scalar variable named name.
+// replaceNode returns false if the variable is not a non-scalar node or
+// it is overridden by other resolvers. n is kept as it is if variables should be kept.
+func (p *varProcessor) replaceNode(n *node, name, path string) (bool, error) {
+	prefix, key, namespaced := splitNamespace(name)
+	if namespaced && !(prefix == "var" && p.IsNamespace(prefix)) {
+		return false, nil
+	}
+	v := p.FindVariable(key)
+	if v == nil || v.Kind == yaml.ScalarNode {
+		return false, nil
+	}
+	if _, ok := p.Overrides[key]; ok && !namespaced {
+		return false, nil
+	}
+	if _, err := p.Resolver(key); err == nil && !namespaced && p.scope().EntryGet(key) == nil {
+		return false, nil
+	}
+	if p.KeepsVariables {
+		return true, nil
+	}
+	for _, e := range p.expanding {
+		if e == key {
+			return true, ErrDirective.New("variable cycle detected: %s", nil,
+				strings.Join(append(append([]string{}, p.expanding...), key), " -> ")).At(n).WithPath(path)
+		}
+	}
+	p.expanding = append(p.expanding, key)
+	defer func() {
+		p.expanding = p.expanding[:len(p.expanding)-1]
+	}()
+	scope := n.Scope
+	*n = *v.Clone()
+	n.SetScope(scope, true)
+	return true, p.Process(n, path)
+}
+
+// FindVariable finds a directive variable named key.
+// If variables are scoped, FindVariable finds it in the scope of the node that is
+// being processed before global variables.
+func (p *varProcessor) FindVariable(key string) *node {
+	if v := p.scope().Get(key); v != nil {
+		return v
+	}
+	if p.Variables != nil && p.Variables.Kind == yaml.MappingNode {
+		return p.Variables.Get(key)
+	}
+	return nil
+}
+
+// scope returns the scope of the node that is being processed.
+func (p *varProcessor) scope() *varScope {
+	if len(p.resolving) != 0 {
+		return p.resolving[len(p.resolving)-1].Scope
+	}
+	return p.Scope
+}
+
+// resolveFile returns contents of the file without trailing newlines.
+// Relative paths are resolved from the directory or the URL of the file that is being processed.
+func (p *varProcessor) resolveFile(path string) (string, error) {
+	if len(p.resolving) != 0 {
+		fullPath, err := resolvePath(p.resolving[len(p.resolving)-1].File, path)
+		if err != nil {
+			return "", ErrIO.New("%s: failed to read a file", err, path)
+		}
+		path = fullPath
+	}
+	bs, err := p.readFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", ErrVarNotFound.New("%s not found", err, path)
+	}
+	if err != nil {
+		return "", ErrIO.New("%s: failed to read a file", err, path)
+	}
+	return strings.TrimRight(string(bs), "\r\n"), nil
+}
+
+func (p *varProcessor) readFile(path string) ([]byte, error) {
+	if isURL(path) {
+		if p.Fetcher == nil {
+			return nil, fmt.Errorf("WithIncludeFetcher is required to read URLs")
+		}
+		return p.Fetcher.Fetch(path)
+	}
+	fp, err := fsOpen(p.FS, path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	return io.ReadAll(fp)
+}
+
+func (p *varProcessor) IsNamespace(prefix string) bool {
+	_, ok := p.Namespaces[prefix]
+	return ok
+}
+
+func (p *varProcessor) Lookup(key string) (string, string, error) {
+	if prefix, name, ok := splitNamespace(key); ok && p.IsNamespace(prefix) {
+		v, err := p.Namespaces[prefix](name)
+		return v, "", err
+	}
+	if !isReference(key) {
+		if v, ok := p.Overrides[key]; ok {
+			v, tag := parseVarValue(v)
+			return v, tag, nil
+		}
+		// variables of include entries take precedence over other sources
+		if v := p.scope().EntryGet(key); v != nil && v.Kind == yaml.ScalarNode {
+			return v.Value, "", nil
+		}
+		v, err := p.Resolver(key)
+		return v, "", err
+	}
+	if p.KeepsVariables {
+		return "", "", ErrVarNotFound.New("%s not found", nil, key)
+	}
+	pointer := referencePointer(key)
+	target, err := p.Root.FindNodeByJSONPointer(pointer)
+	if err != nil {
+		return "", "", ErrVarNotFound.New("%s not found", nil, key)
+	}
+	for _, r := range p.resolving {
+		if r == target {
+			return "", "", ErrDirective.New("reference cycle detected: %s", nil,
+				strings.Join(append(append([]string{}, p.paths...), pointer), " -> "))
+		}
+	}
+	if err := p.processScalar(target, pointer); err != nil {
+		return "", "", err
+	}
+	if target.Kind != yaml.ScalarNode {
+		return "", "", ErrDirective.New("reference %s must be a scalar node", nil, key)
+	}
+	tag := "str"
+	if strings.HasPrefix(target.Tag, "!!") {
+		tag = target.Tag[2:]
+	}
+	return target.Value, tag, nil
+}
+
 func cleanJSONPatch(jsonValue any) any {
 	switch jv := jsonValue.(type) {
 	case float64:
@@ -0,0 +1,252 @@
+package yammy_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"testing/iotest"
+
+	. "github.com/yuin/yammy"
+	"go.yaml.in/yaml/v3"
+)
+
+func TestLoadAll(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - base.yml
+  variables:
+    name: first
+kind: Service
+name: ${name}
+---
+_directives:
+  patches:
+    - op: add
+      path: /replicas
+      value: 3
+kind: Deployment
+name: ${name:second}
+---
+`),
+		"base.yml": []byte(`
+labels:
+  app: test
+`),
+	})
+	var result []map[string]any
+	err := LoadAll("test.yml", &result, WithFileSystem(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[{"kind":"Service","labels":{"app":"test"},"name":"first"},` +
+		`{"kind":"Deployment","name":"second","replicas":3}]`
+	if expected != string(bs) {
+		t.Errorf("expected:\n--------------\n%s\n\nactual:\n---------------\n%s\n",
+			expected, string(bs))
+	}
+
+	var nodes []yaml.Node
+	err = LoadAll("test.yml", &nodes, WithFileSystem(fs), WithSourceMapComment())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("2 documents expected, but got %d", len(nodes))
+	}
+	bs, err = yaml.Marshal(&nodes[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedYAML := `kind: Deployment #  test.yml:15
+name: second #  test.yml:16
+replicas: 3 #  test.yml:14
+`
+	if expectedYAML != string(bs) {
+		t.Errorf("sourcemap has some problems: \n%s", string(bs))
+	}
+
+	var single map[string]any
+	err = Load("test.yml", &single, WithFileSystem(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if "Service" != single["kind"] {
+		t.Errorf("Load should load the first document: %#v", single)
+	}
+
+	var empty []map[string]any
+	err = LoadAllBytes("empty.yml", []byte("# comment only\n"), &empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(empty) != 1 || len(empty[0]) != 0 {
+		t.Errorf("an empty stream should be loaded as an empty mapping: %#v", empty)
+	}
+}
+
+func TestLoadAllInvalidDest(t *testing.T) {
+	var result map[string]any
+	err := LoadAll("test.yml", &result)
+	if err == nil || "yammy error: dest must be a pointer to a slice, but got *map[string]interface {}" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+func TestLoadBytes(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"configs/base.yml": []byte(`
+base: 1
+`),
+	})
+	data := []byte(`
+_directives:
+  include:
+    - base.yml
+name: test
+`)
+	var result yaml.Node
+	err := LoadBytes("configs/memory.yml", data, &result, WithFileSystem(fs), WithSourceMapComment())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := yaml.Marshal(&result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `base: 1 #  configs/base.yml:2
+name: test #  configs/memory.yml:5
+`
+	if expected != string(bs) {
+		t.Errorf("expected:\n--------------\n%s\n\nactual:\n---------------\n%s\n",
+			expected, string(bs))
+	}
+
+	var m map[string]any
+	err = LoadReader("configs/memory.yml", bytes.NewReader(data), &m, WithFileSystem(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if "test" != m["name"] || 1 != m["base"] {
+		t.Errorf("failed to load from a reader: %#v", m)
+	}
+
+	var docs []map[string]any
+	err = LoadAllReader("configs/memory.yml", bytes.NewReader(append(data, "---\nname: test2\n"...)), &docs,
+		WithFileSystem(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 2 || "test2" != docs[1]["name"] {
+		t.Errorf("failed to load all documents from a reader: %#v", docs)
+	}
+}
+
+func TestLoadReaderError(t *testing.T) {
+	var m map[string]any
+	err := LoadReader("memory.yml", iotest.ErrReader(errors.New("read error")), &m)
+	if err == nil || "io error: memory.yml: failed to read given data: read error: yammy error" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - base.yml
+  variables:
+    replicas: 1
+    region: us
+  profiles:
+    prod:
+      include:
+        - prod.yml
+      patches:
+        - op: replace
+          path: /debug
+          value: false
+      variables:
+        replicas: 3
+    eu:
+      variables:
+        region: eu
+name: test
+debug: true
+replicas: ${replicas:1}
+region: ${region}
+`),
+		"base.yml": []byte(`
+_directives:
+  profiles:
+    prod:
+      patches:
+        - op: add
+          path: /base
+          value: prod
+base: default
+log: debug
+`),
+		"prod.yml": []byte(`
+log: info
+name: prod
+`),
+	})
+	cases := []struct {
+		name     string
+		profiles []string
+		expected string
+	}{
+		{
+			name:     "none",
+			expected: `{"base":"default","debug":true,"log":"debug","name":"test","region":"us","replicas":1}`,
+		},
+		{
+			name:     "prod",
+			profiles: []string{"prod"},
+			expected: `{"base":"prod","debug":false,"log":"info","name":"prod","region":"us","replicas":3}`,
+		},
+		{
+			name:     "prod,eu",
+			profiles: []string{"prod", "eu"},
+			expected: `{"base":"prod","debug":false,"log":"info","name":"prod","region":"eu","replicas":3}`,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var result map[string]any
+			err := Load("test.yml", &result, WithFileSystem(fs), WithProfiles(tt.profiles...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			bs, err := json.Marshal(result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.expected != string(bs) {
+				t.Errorf("expected:\n--------------\n%s\n\nactual:\n---------------\n%s\n",
+					tt.expected, string(bs))
+			}
+		})
+	}
+
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs), WithProfiles("prod", "stg"))
+	if err == nil || "directive error: profile stg is not defined: yammy error" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+
+	var docs []map[string]any
+	err = LoadAllBytes("multi.yml", []byte("_directives:\n  profiles:\n    eu: {}\n---\nname: test\n"), &docs,
+		WithFileSystem(fs), WithProfiles("eu"))
+	if err != nil {
+		t.Errorf("profiles defined in one of documents should be active: %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package yammy
+
+import (
+	"fmt"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// MergeStrategy is a strategy that is used when included nodes are merged.
+type MergeStrategy string
+
+const (
+	// MergeAppend appends sequence items. Mappings are merged recursively.
+	// This is the default strategy.
+	MergeAppend MergeStrategy = "append"
+
+	// MergePrepend prepends sequence items. Mappings are merged recursively.
+	MergePrepend MergeStrategy = "prepend"
+
+	// MergeReplace replaces sequences and mappings wholesale.
+	MergeReplace MergeStrategy = "replace"
+)
+
+const mergeByKeyPrefix = "mergeByKey:"
+
+const (
+	mergeTagReplace = "!replace"
+	mergeTagAppend  = "!append"
+	mergeTagDelete  = "!delete"
+)
+
+// MergeByKey returns a strategy that merges sequence items that have
+// the same field value. Items that do not match any existing items are appended.
+func MergeByKey(field string) MergeStrategy {
+	return MergeStrategy(mergeByKeyPrefix + field)
+}
+
+// Key returns a field name if this is a strategy created by [MergeByKey],
+// otherwise returns an empty string.
+func (s MergeStrategy) Key() string {
+	if strings.HasPrefix(string(s), mergeByKeyPrefix) {
+		return string(s)[len(mergeByKeyPrefix):]
+	}
+	return ""
+}
+
+func (s MergeStrategy) validate() error {
+	switch s {
+	case MergeAppend, MergePrepend, MergeReplace:
+		return nil
+	}
+	if len(s.Key()) != 0 {
+		return nil
+	}
+	return fmt.Errorf("unknown merge strategy: %s", string(s))
+}
+
+func parseMergeStrategy(n *node) (MergeStrategy, error) {
+	var s MergeStrategy
+	switch n.Kind {
+	case yaml.ScalarNode:
+		s = MergeStrategy(n.Value)
+	case yaml.MappingNode:
+		if len(n.Content) != 2 || n.Content[0].Value != "mergeByKey" ||
+			n.Content[1].Kind != yaml.ScalarNode {
+			return "", fmt.Errorf("invalid merge strategy(mergeByKey: <field> is expected)")
+		}
+		s = MergeByKey(n.Content[1].Value)
+	default:
+		return "", fmt.Errorf("invalid merge strategy(%s)", n.KindString())
+	}
+	return s, s.validate()
+}
+
+// KeyOrder is an order of mapping keys that are added by merging and patching.
+type KeyOrder string
+
+const (
+	// KeyOrderSorted inserts new keys at alphabetically sorted positions.
+	// This is the default order.
+	KeyOrderSorted KeyOrder = "sorted"
+
+	// KeyOrderSource keeps the order of keys in the file that adds them.
+	// A new key is placed next to keys that are adjacent to it in the file,
+	// so keys of an includer keep its order around keys of included files.
+	KeyOrderSource KeyOrder = "source"
+
+	// KeyOrderAppend appends new keys to the end of mappings.
+	KeyOrderAppend KeyOrder = "append"
+)
+
+func (o KeyOrder) validate() error {
+	switch o {
+	case KeyOrderSorted, KeyOrderSource, KeyOrderAppend:
+		return nil
+	}
+	return fmt.Errorf("unknown key order: %s", string(o))
+}
+
+type mergeOptions struct {
+	// Strategies is a mapping of JSON pointers and strategies.
+	Strategies map[string]MergeStrategy
+
+	// KeyOrder is an order of new keys.
+	KeyOrder KeyOrder
+}
+
+func (o *mergeOptions) Order() KeyOrder {
+	if o == nil || len(o.KeyOrder) == 0 {
+		return KeyOrderSorted
+	}
+	return o.KeyOrder
+}
+
+func (o *mergeOptions) Strategy(path string) MergeStrategy {
+	if o != nil {
+		if s, ok := o.Strategies[path]; ok {
+			return s
+		}
+	}
+	return MergeAppend
+}
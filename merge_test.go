@@ -0,0 +1,344 @@
+package yammy_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/yuin/yammy"
+	"go.yaml.in/yaml/v3"
+)
+
+func TestMergePatch(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - base.yml
+  mergePatch:
+    debug: null
+    server:
+      host: example.com
+      tls: ~
+    ports:
+      - 443
+    logging:
+      level: info
+      sink: null
+`),
+		"base.yml": []byte(`
+debug: true
+server:
+  host: localhost
+  port: 8080
+  tls:
+    cert: a.pem
+ports:
+  - 80
+  - 8080
+`),
+	})
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"logging":{"level":"info"},"ports":[443],"server":{"host":"example.com","port":8080}}`
+	if expected != string(bs) {
+		t.Errorf("expected:\n--------------\n%s\n\nactual:\n---------------\n%s\n",
+			expected, string(bs))
+	}
+}
+
+func TestMergePatchSourceMap(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - base.yml
+  mergePatch:
+    server:
+      host: example.com
+`),
+		"base.yml": []byte(`
+server:
+  host: localhost
+  port: 8080
+`),
+	})
+	var result yaml.Node
+	err := Load("test.yml", &result, WithFileSystem(fs), WithSourceMapComment())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := yaml.Marshal(&result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `server: #  base.yml:2
+    host: example.com #  test.yml:7
+    port: 8080 #  base.yml:4
+`
+	if expected != string(bs) {
+		t.Errorf("sourcemap has some problems: \n%s", string(bs))
+	}
+}
+
+func TestMergePatchError(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  mergePatch:
+    - aaa
+`),
+	})
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs))
+	if err == nil || "directive error: test.yml(line:4): mergePatch must be a mapping node: "+
+		"yammy error" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+func TestMergeStrategies(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - base.yml
+  merge:
+    /ports: replace
+    /args: prepend
+    /env: replace
+    /containers:
+      mergeByKey: name
+ports:
+  - 443
+args:
+  - --verbose
+env:
+  B: 2
+containers:
+  - name: app
+    image: app:v2
+  - name: sidecar
+    image: sidecar:v1
+`),
+		"base.yml": []byte(`
+ports:
+  - 80
+  - 8080
+args:
+  - --config
+  - app.yml
+env:
+  A: 1
+containers:
+  - name: app
+    image: app:v1
+    cpu: 1
+  - name: logger
+    image: logger:v1
+`),
+	})
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"args":["--verbose","--config","app.yml"],"containers":[{"cpu":1,"image":"app:v2","name":"app"},` +
+		`{"image":"logger:v1","name":"logger"},{"image":"sidecar:v1","name":"sidecar"}],` +
+		`"env":{"B":2},"ports":[443]}`
+	if expected != string(bs) {
+		t.Errorf("expected:\n--------------\n%s\n\nactual:\n---------------\n%s\n",
+			expected, string(bs))
+	}
+}
+
+func TestMergeStrategyLoadOption(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - base.yml
+  merge:
+    /ports: prepend
+ports:
+  - 443
+`),
+		"base.yml": []byte(`
+ports:
+  - 80
+`),
+	})
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs), WithMergeStrategy("/ports", MergeReplace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, _ := json.Marshal(result)
+	if `{"ports":[443]}` != string(bs) {
+		t.Errorf("WithMergeStrategy should take precedence over directives: %s", string(bs))
+	}
+
+	err = Load("test.yml", &result, WithFileSystem(fs), WithMergeStrategy("/ports", MergeStrategy("unknown")))
+	if err == nil || "directive error: /ports: unknown merge strategy: unknown: yammy error" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+func TestMergeStrategyError(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  merge:
+    /ports:
+      mergeByKey: [name]
+`),
+	})
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs))
+	if err == nil || "directive error: test.yml(line:5): invalid merge strategy"+
+		"(mergeByKey: <field> is expected): yammy error" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+func TestMergeTags(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - base.yml
+  merge:
+    /args: replace
+ports: !replace
+  - 443
+args: !append
+  - --verbose
+env: !replace
+  B: ${B:2}
+debug: !delete
+unknown: !delete
+`),
+		"base.yml": []byte(`
+debug: true
+ports:
+  - 80
+args:
+  - --config
+env:
+  A: 1
+`),
+	})
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"args":["--config","--verbose"],"env":{"B":2},"ports":[443]}`
+	if expected != string(bs) {
+		t.Errorf("expected:\n--------------\n%s\n\nactual:\n---------------\n%s\n",
+			expected, string(bs))
+	}
+
+	var n yaml.Node
+	err = Load("test.yml", &n, WithFileSystem(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err = yaml.Marshal(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedYAML := `ports:
+    - 443
+args:
+    - --config
+    - --verbose
+env:
+    B: 2
+`
+	if expectedYAML != string(bs) {
+		t.Errorf("merge tags should be removed: \n%s", string(bs))
+	}
+}
+
+func TestKeyOrder(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - base.yml
+  patches:
+    - op: add
+      path: /b
+      value: 1
+    - op: replace
+      path: /z
+      value: 2
+zz: 0
+y: 0
+z: 0
+x: 0
+`),
+		"base.yml": []byte(`
+z: 1
+a: 1
+`),
+	})
+	cases := []struct {
+		order    KeyOrder
+		expected string
+	}{
+		{
+			order:    KeyOrderSorted,
+			expected: "b: 1\nx: 0\ny: 0\na: 1\nz: 2\nzz: 0\n",
+		},
+		{
+			order:    KeyOrderSource,
+			expected: "zz: 0\ny: 0\nz: 2\nx: 0\na: 1\nb: 1\n",
+		},
+		{
+			order:    KeyOrderAppend,
+			expected: "z: 2\na: 1\nzz: 0\ny: 0\nx: 0\nb: 1\n",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(string(tt.order), func(t *testing.T) {
+			var n yaml.Node
+			err := Load("test.yml", &n, WithFileSystem(fs), WithKeyOrder(tt.order))
+			if err != nil {
+				t.Fatal(err)
+			}
+			bs, err := yaml.Marshal(&n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.expected != string(bs) {
+				t.Errorf("expected:\n--------------\n%s\n\nactual:\n---------------\n%s\n",
+					tt.expected, string(bs))
+			}
+		})
+	}
+
+	var n yaml.Node
+	err := Load("test.yml", &n, WithFileSystem(fs), WithKeyOrder(KeyOrder("unknown")))
+	if err == nil || "yammy error: unknown key order: unknown" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
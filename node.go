@@ -3,6 +3,7 @@ package yammy
 import (
 	"errors"
 	"fmt"
+	"reflect"
 
 	"go.yaml.in/yaml/v3"
 )
@@ -14,6 +15,10 @@ type node struct {
 	*yaml.Node
 	File    string
 	Content []*node
+
+	// Scope is a scope of variables that is used when variables are
+	// scoped per file.
+	Scope *varScope
 }
 
 func newStringNode(s string, file string) *node {
@@ -125,6 +130,17 @@ func (n *node) FindNodeByJSONPointer(path string) (*node, error) {
 	return ret, nil
 }
 
+// SetScope sets the scope to n and its descendants.
+// If overwrite is false, SetScope does not change nodes that already have a scope.
+func (n *node) SetScope(scope *varScope, overwrite bool) {
+	if n.Scope == nil || overwrite {
+		n.Scope = scope
+	}
+	for _, c := range n.Content {
+		c.SetScope(scope, overwrite)
+	}
+}
+
 func (n *node) KindString() string {
 	switch n.Kind {
 	case yaml.DocumentNode:
@@ -226,6 +242,10 @@ func (n *node) Delete(key string) *node {
 }
 
 func (n *node) Put(key, value *node) *node {
+	return n.PutWithOrder(key, value, KeyOrderSorted)
+}
+
+func (n *node) PutWithOrder(key, value *node, order KeyOrder) *node {
 	if n.Kind != yaml.MappingNode {
 		return nil
 	}
@@ -239,7 +259,7 @@ func (n *node) Put(key, value *node) *node {
 	}
 
 	pos := len(n.Content)
-	if key.Kind == yaml.ScalarNode {
+	if key.Kind == yaml.ScalarNode && order == KeyOrderSorted {
 		for i := 0; i < len(n.Content); i += 2 {
 			if key.Value < n.Content[i].Value {
 				pos = i
@@ -248,14 +268,103 @@ func (n *node) Put(key, value *node) *node {
 		}
 	}
 
-	n.Content = append(n.Content[:pos], append([]*node{key, value}, n.Content[pos:]...)...)
+	n.insert(pos, key, value)
 	return nil
 }
 
+// putFrom puts the key at index i in the mapping src and given value.
+// With [KeyOrderSource], a new key is placed next to keys that are
+// adjacent to it in src.
+func (n *node) putFrom(src *node, i int, value *node, order KeyOrder) {
+	key := src.Content[i]
+	if order != KeyOrderSource || n.HasKey(key) {
+		n.PutWithOrder(key, value, order)
+		return
+	}
+	for j := i - 2; j >= 0; j -= 2 {
+		if pos := n.indexOf(src.Content[j].Value); pos > -1 {
+			n.insert(pos+2, key, value)
+			return
+		}
+	}
+	for j := i + 2; j < len(src.Content); j += 2 {
+		if pos := n.indexOf(src.Content[j].Value); pos > -1 {
+			n.insert(pos, key, value)
+			return
+		}
+	}
+	n.insert(len(n.Content), key, value)
+}
+
+func (n *node) indexOf(key string) int {
+	for i := 0; i < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func (n *node) insert(pos int, key, value *node) {
+	n.Content = append(n.Content[:pos], append([]*node{key, value}, n.Content[pos:]...)...)
+}
+
 func (n *node) Decode(target any) error {
 	return n.ToYAMLNode().Decode(target)
 }
 
+func (n *node) Clone() *node {
+	nd := *n.Node
+	ret := &node{
+		Node:  &nd,
+		File:  n.File,
+		Scope: n.Scope,
+	}
+	nd.Content = make([]*yaml.Node, len(n.Content))
+	for i, c := range n.Content {
+		ret.Content = append(ret.Content, c.Clone())
+		nd.Content[i] = ret.Content[i].Node
+	}
+	return ret
+}
+
+func (n *node) Equal(other *node) bool {
+	var v1, v2 any
+	if err := n.Decode(&v1); err != nil {
+		return false
+	}
+	if err := other.Decode(&v2); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(normalizeNumbers(v1), normalizeNumbers(v2))
+}
+
+// normalizeNumbers converts numbers in the value to float64 so that
+// numbers are compared by their values like '1' and '1.0'(RFC 6902 4.6).
+func normalizeNumbers(value any) any {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case map[string]any:
+		for k, e := range v {
+			v[k] = normalizeNumbers(e)
+		}
+	case map[any]any:
+		for k, e := range v {
+			v[k] = normalizeNumbers(e)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = normalizeNumbers(e)
+		}
+	}
+	return value
+}
+
 func (n *node) Append(value *node) {
 	if n.Kind != yaml.SequenceNode {
 		return
@@ -309,29 +418,52 @@ func (n *node) AddSourceComments() {
 	}
 }
 
-func (n *node) Merge(other *node) (*node, error) {
+func (n *node) Merge(other *node, opts *mergeOptions) (*node, error) {
+	return n.merge(other, "/", opts)
+}
+
+func (n *node) merge(other *node, path string, opts *mergeOptions) (*node, error) {
 	if n.Kind != other.Kind {
 		return other, nil
 	}
+	strategy := opts.Strategy(path)
+	switch other.Tag {
+	case mergeTagReplace:
+		strategy = MergeReplace
+	case mergeTagAppend:
+		strategy = MergeAppend
+	}
+	if strategy == MergeReplace {
+		return other, nil
+	}
 	switch n.Kind {
 	case yaml.MappingNode:
-		err := other.ForEachMap(func(k, v *node) error {
+		for i := 0; i < len(other.Content); i += 2 {
+			k := other.Content[i]
+			v := other.Content[i+1]
+			if v.Tag == mergeTagDelete {
+				n.Delete(k.Value)
+				continue
+			}
 			if n.HasKey(k) {
-				nv, err := n.Get(k.Value).Merge(v)
+				nv, err := n.Get(k.Value).merge(v, mustJSONPointer(path, k.Value), opts)
 				if err != nil {
-					return err
+					return nil, err
 				}
 				n.Put(k, nv)
 			} else {
-				n.Put(k, v)
+				n.putFrom(other, i, v, opts.Order())
 			}
-			return nil
-		})
-		if err != nil {
-			return nil, err
 		}
 		return n, nil
 	case yaml.SequenceNode:
+		if strategy == MergePrepend {
+			n.Content = append(append([]*node{}, other.Content...), n.Content...)
+			return n, nil
+		}
+		if key := strategy.Key(); len(key) != 0 {
+			return n, n.mergeByKey(other, key, path, opts)
+		}
 		_ = other.ForEachSeq(func(_ int, v *node) error {
 			n.Append(v)
 			return nil
@@ -342,6 +474,87 @@ func (n *node) Merge(other *node) (*node, error) {
 	}
 }
 
+func (n *node) mergeByKey(other *node, key, path string, opts *mergeOptions) error {
+	return other.ForEachSeq(func(_ int, v *node) error {
+		kv := v.Get(key)
+		if kv == nil || kv.Kind != yaml.ScalarNode {
+			n.Append(v)
+			return nil
+		}
+		for i, item := range n.Content {
+			if ikv := item.Get(key); ikv != nil && ikv.Kind == yaml.ScalarNode && ikv.Value == kv.Value {
+				nv, err := item.merge(v, mustJSONPointer(path, i), opts)
+				if err != nil {
+					return err
+				}
+				n.Content[i] = nv
+				return nil
+			}
+		}
+		n.Append(v)
+		return nil
+	})
+}
+
+func (n *node) StripMergeTags() {
+	switch n.Tag {
+	case mergeTagReplace, mergeTagAppend, mergeTagDelete:
+		n.Style &^= yaml.TaggedStyle
+		n.Tag = ""
+		n.Tag = n.ShortTag()
+	}
+	switch n.Kind {
+	case yaml.MappingNode:
+		newContent := make([]*node, 0, len(n.Content))
+		_ = n.ForEachMap(func(k, v *node) error {
+			if v.Tag != mergeTagDelete {
+				newContent = append(newContent, k, v)
+			}
+			return nil
+		})
+		n.Content = newContent
+	case yaml.SequenceNode:
+		newContent := make([]*node, 0, len(n.Content))
+		_ = n.ForEachSeq(func(_ int, v *node) error {
+			if v.Tag != mergeTagDelete {
+				newContent = append(newContent, v)
+			}
+			return nil
+		})
+		n.Content = newContent
+	}
+	for _, c := range n.Content {
+		c.StripMergeTags()
+	}
+}
+
+// MergePatch applies the patch to this node with JSON Merge Patch(RFC 7386) semantics.
+// n can be nil.
+func (n *node) MergePatch(patch *node, order KeyOrder) *node {
+	if patch.Kind != yaml.MappingNode {
+		return patch
+	}
+	target := n
+	if target == nil || target.Kind != yaml.MappingNode {
+		nd := *patch.Node
+		nd.Content = nil
+		target = &node{
+			Node: &nd,
+			File: patch.File,
+		}
+	}
+	for i := 0; i < len(patch.Content); i += 2 {
+		k := patch.Content[i]
+		v := patch.Content[i+1]
+		if v.Kind == yaml.ScalarNode && v.Tag == "!!null" {
+			target.Delete(k.Value)
+			continue
+		}
+		target.putFrom(patch, i, target.Get(k.Value).MergePatch(v, order), order)
+	}
+	return target
+}
+
 func (n *node) ClearPosition(recursive bool) {
 	n.Line = 1
 	n.Column = 1
@@ -357,6 +570,10 @@ type SourceMap struct {
 
 	// Mappings is a mappings that nodes and files.
 	Mappings []*Mapping
+
+	// Skipped is a list of optional included files that are skipped
+	// because they do not exist.
+	Skipped []string `yaml:",omitempty"`
 }
 
 // Mapping is a mapping that nodes and files.
@@ -1,6 +1,7 @@
 package yammy_test
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"strings"
@@ -41,6 +42,18 @@ test:
 	if "bbb" != result["test"].(map[string]any)["value2"].([]any)[1] {
 		t.Error("failed to patch variables")
 	}
+
+	result = nil
+	err = Load("test.yml", &result, WithFileSystem(fs), WithJSONPatches([]map[string]any{
+		{"op": "add", "path": "/x", "value": 1, "when": "true"},
+		{"op": "add", "path": "/y", "value": 1, "when": "false"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result["y"]; ok || result["x"] != 1 {
+		t.Errorf("patches should be applied only if their conditions are true: %#v", result)
+	}
 }
 
 func TestPatchRemoveError(t *testing.T) {
@@ -278,4 +291,159 @@ test:
 	if "bbb" != result["test"].(map[string]any)["value2"].([]any)[1] {
 		t.Error("failed to patch variables")
 	}
+
+	result = nil
+	err = Load("test.yml", &result, WithFileSystem(fs), WithJSONPatches([]map[string]any{
+		{"op": "add", "path": "/x", "value": 1, "when": "true"},
+		{"op": "add", "path": "/y", "value": 1, "when": "false"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result["y"]; ok || result["x"] != 1 {
+		t.Errorf("patches should be applied only if their conditions are true: %#v", result)
+	}
+}
+
+func TestPatchMove(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  patches:
+    - op: move
+      from: /test/value
+      path: /test/moved
+    - op: move
+      from: /test/value2/0
+      path: /test/value2/-
+test:
+  value: 10
+  value2:
+    - "000"
+    - "111"
+`),
+	})
+
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := result["test"].(map[string]any)
+	if _, ok := test["value"]; ok {
+		t.Error("moved value should be removed")
+	}
+	if 10 != test["moved"] {
+		t.Error("failed to move a value")
+	}
+	if !reflect.DeepEqual([]any{"111", "000"}, test["value2"]) {
+		t.Errorf("failed to move a sequence item: %#v", test["value2"])
+	}
+}
+
+func TestPatchCopy(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  patches:
+    - op: copy
+      from: /test/value
+      path: /copied
+    - op: add
+      path: /copied/c
+      value: 30
+test:
+  value:
+    a: 10
+    b: 20
+`),
+	})
+
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(map[string]any{"a": 10, "b": 20}, result["test"].(map[string]any)["value"]) {
+		t.Errorf("copy source should not be modified: %#v", result["test"])
+	}
+	if !reflect.DeepEqual(map[string]any{"a": 10, "b": 20, "c": 30}, result["copied"]) {
+		t.Errorf("failed to copy a value: %#v", result["copied"])
+	}
+}
+
+func TestPatchTest(t *testing.T) {
+	cases := []struct {
+		name  string
+		value string
+		err   string
+	}{
+		{
+			name:  "equal",
+			value: "value: {a: 10, b: [x, y]}",
+		},
+		{
+			name:  "numberEqual",
+			value: "value: {a: 10.0, b: [x, y]}",
+		},
+		{
+			name:  "notEqual",
+			value: "value: {a: \"10\", b: [x, y]}",
+			err: "directive error: test.yml(line:4): test failed: /test is not equal " +
+				"to the expected value: yammy error",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newMockFS(map[string][]byte{
+				"test.yml": []byte(fmt.Sprintf(`
+_directives:
+  patches:
+    - op: test
+      path: /test
+      %s
+test:
+  a: 10
+  b:
+    - x
+    - y
+`, tt.value)),
+			})
+
+			var result map[string]any
+			err := Load("test.yml", &result, WithFileSystem(fs))
+			if len(tt.err) == 0 {
+				if err != nil {
+					t.Error(err.Error())
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("err should be '%s', but got %v", tt.err, err)
+			}
+			if !errors.Is(err, ErrDirective) {
+				t.Errorf("err should be an ErrDirective")
+			}
+		})
+	}
+}
+
+func TestPatchMoveError(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  patches:
+    - op: move
+      path: /test/value/a
+test:
+  value: 10
+`),
+	})
+
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs))
+	if err == nil || "directive error: test.yml(line:4): invalid patch(from is required "+
+		"for a move operation): yammy error" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
 }
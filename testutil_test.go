@@ -1,7 +1,6 @@
 package yammy_test
 
 import (
-	"fmt"
 	"io"
 	"io/fs"
 	"path/filepath"
@@ -119,5 +118,5 @@ func (f *mapFS) Open(path string) (fs.File, error) {
 		}
 		return newMockFile(filepath.Base(path), v), nil
 	}
-	return nil, fmt.Errorf("open %s: no such file or directory", path)
+	return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
 }
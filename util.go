@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strconv"
@@ -86,17 +87,67 @@ func isVarName(c byte, i int) bool {
 }
 
 type vvv struct {
-	start int
-	end   int
-	name  string
-	def   string
-	tag   string
+	start      int
+	end        int
+	name       string
+	def        string
+	hasDef     bool
+	tag        string
+	required   bool
+	filters    []varFilter
+	filterText string
+}
+
+// setFilters parses filters starts at i and returns an index of the closing brace.
+// setFilters returns -1 if filters are invalid.
+func (va *vvv) setFilters(v string, i int) int {
+	filters, end := parseVarFilters(v, i)
+	if end < 0 {
+		return -1
+	}
+	va.filters = filters
+	va.filterText = v[i:end]
+	va.end = end + 1
+	return end
 }
 
 // VarResolver resolves variables named key.
 // VarResolver returns [ErrVarNotFound] if variables not found.
 type VarResolver func(key string) (string, error)
 
+// VarSource is a source of variables.
+type VarSource string
+
+const (
+	// VarSourceEnv means environment variables.
+	// If [WithVarResolver] is specified, the resolver is used instead.
+	VarSourceEnv VarSource = "env"
+
+	// VarSourceDotEnv means dotenv files.
+	VarSourceDotEnv VarSource = "dotenv"
+
+	// VarSourceDirective means variables that are defined in yammy directives.
+	VarSourceDirective VarSource = "directive"
+)
+
+var defaultVarPrecedence = []VarSource{VarSourceEnv, VarSourceDotEnv, VarSourceDirective}
+
+func validateVarPrecedence(sources []VarSource) error {
+	seen := map[VarSource]bool{}
+	for _, s := range sources {
+		switch s {
+		case VarSourceEnv, VarSourceDotEnv, VarSourceDirective:
+		default:
+			return fmt.Errorf("unknown variable source: %s", string(s))
+		}
+		if seen[s] {
+			return fmt.Errorf("duplicated variable source: %s", string(s))
+		}
+		seen[s] = true
+	}
+	return nil
+}
+
 func newCompositeVarResolver(resolvers ...VarResolver) VarResolver {
 	return func(key string) (string, error) {
 		for _, r := range resolvers {
@@ -110,15 +161,26 @@ func newCompositeVarResolver(resolvers ...VarResolver) VarResolver {
 	}
 }
 
-func newDirectiveVarResolver(vars *node) VarResolver {
+func newDirectiveVarResolver(find func(key string) *node) VarResolver {
 	return func(key string) (string, error) {
-		if vars != nil && vars.Kind == yaml.MappingNode {
-			v := vars.Get(key)
-			if v != nil {
-				if v.Kind != yaml.ScalarNode {
-					return "", ErrDirective.New("variable %s must be a scalar node", nil, key)
-				}
-				return v.Value, nil
+		v := find(key)
+		if v != nil {
+			if v.Kind != yaml.ScalarNode {
+				return "", ErrDirective.New("variable %s must be a scalar node", nil, key)
+			}
+			return v.Value, nil
+		}
+		return "", ErrVarNotFound.New("%s not found", nil, key)
+	}
+}
+
+// newAllowlistVarResolver returns a resolver that resolves only variables
+// match one of the patterns. Patterns are same as [path.Match] .
+func newAllowlistVarResolver(resolver VarResolver, patterns []string) VarResolver {
+	return func(key string) (string, error) {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, key); ok {
+				return resolver(key)
 			}
 		}
 		return "", ErrVarNotFound.New("%s not found", nil, key)
@@ -133,11 +195,66 @@ func envVarResolver(key string) (string, error) {
 	return "", ErrVarNotFound.New("%s not found", nil, key)
 }
 
-func expandVar(v string, resolv VarResolver, keepsVariables bool) (string, error) {
+// varLookup resolves variables in expandVar.
+type varLookup interface {
+	// Lookup resolves a variable named key like [VarResolver] .
+	// Lookup also returns a tag name(like 'int') if the value has an explicit type,
+	// otherwise returns an empty string.
+	Lookup(key string) (value string, tag string, err error)
+
+	// IsNamespace returns true if the prefix is a variable namespace like 'env'.
+	IsNamespace(prefix string) bool
+}
+
+// splitNamespace splits a variable name like 'env:HOME' into a namespace and a key.
+func splitNamespace(name string) (string, string, bool) {
+	i := strings.Index(name, ":")
+	if i < 0 {
+		return "", name, false
+	}
+	return name[:i], name[i+1:], true
+}
+
+var singleVar = regexp.MustCompile(`^\$\{((?:var:)?[a-zA-Z][a-zA-Z0-9_-]*)\}$`)
+
+// singleVarName returns a variable name if v consists of a single variable
+// without default values.
+func singleVarName(v string) (string, bool) {
+	m := singleVar.FindStringSubmatch(v)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+func isReference(name string) bool {
+	return strings.HasPrefix(name, "/") || strings.HasPrefix(name, ".")
+}
+
+// referencePointer converts a reference like '/a/b' or '.a.b' into a JSON Pointer.
+func referencePointer(ref string) string {
+	if !strings.HasPrefix(ref, ".") {
+		return ref
+	}
+	if ref == "." {
+		return "/"
+	}
+	parts := strings.Split(ref[1:], ".")
+	for i, part := range parts {
+		part = strings.ReplaceAll(part, "~", "~0")
+		parts[i] = strings.ReplaceAll(part, "/", "~1")
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// expandVar expands variables in v. where is a position of v that is used in
+// error messages for required variables.
+func expandVar(v string, lookup varLookup, keepsVariables bool, where string) (string, error) {
 	i := 0
 	state := 0
 	varStarts := -1
 	varName := ""
+	required := false
 	var vars []vvv
 	for ; i < len(v); i++ {
 		c := v[i]
@@ -159,18 +276,44 @@ func expandVar(v string, resolv VarResolver, keepsVariables bool) (string, error
 			state = 2
 		case 2: // var name
 			j := i
+			if isReference(v[i:]) {
+				for ; j < len(v) && v[j] != '}' && v[j] != ':' && v[j] != '|'; j++ { //nolint
+				}
+				varName = v[i:j]
+				i = j - 1
+				state = 3
+				continue
+			}
 			for ; j < len(v) && isVarName(v[j], j); j++ { //nolint
 			}
 			varName = v[i:j]
-			i = j - 1
 			if len(varName) == 0 {
+				i = j - 1
 				state = 0
 				continue
 			}
+			if j < len(v) && v[j] == ':' && lookup.IsNamespace(varName) {
+				k := j + 1
+				for ; k < len(v) && v[k] != '}' && v[k] != ':' && v[k] != '|'; k++ { //nolint
+				}
+				if k == j+1 {
+					i = j - 1
+					state = 0
+					continue
+				}
+				varName = v[i:k]
+				j = k
+			}
+			i = j - 1
 			state = 3
 		case 3: // default value or end var
+			required = false
 			if c == ':' {
 				state = 4
+				if i+1 < len(v) && v[i+1] == '?' {
+					required = true
+					i++
+				}
 				continue
 			}
 			if c == '}' {
@@ -182,6 +325,18 @@ func expandVar(v string, resolv VarResolver, keepsVariables bool) (string, error
 				})
 				state = 0
 			}
+			if c == '|' {
+				va := vvv{
+					start: varStarts,
+					name:  varName,
+					tag:   "str",
+				}
+				state = 0
+				if end := va.setFilters(v, i); end > -1 {
+					i = end
+					vars = append(vars, va)
+				}
+			}
 		case 4: // default value
 			if c == '"' {
 				value, end := parseVarString(v, i, c)
@@ -190,19 +345,29 @@ func expandVar(v string, resolv VarResolver, keepsVariables bool) (string, error
 					continue
 				}
 				i = end - 1
-				if v[end] == '}' {
-					va := vvv{
-						start: varStarts,
-						end:   end + 1,
-						name:  varName,
+				va := vvv{
+					start: varStarts,
+					end:   end + 1,
+					name:  varName,
+				}
+				va.def = string(value)
+				va.hasDef = true
+				va.tag = "str"
+				va.required = required
+				if v[end] == '|' {
+					if end = va.setFilters(v, end); end < 0 {
+						continue
 					}
-					va.def = string(value)
-					va.tag = "str"
+					i = end
+				}
+				if v[end] == '}' {
 					vars = append(vars, va)
 				}
 			} else {
 				j := i
-				for ; j < len(v) && v[j] != '}'; j++ { //nolint
+				// '|' in unquoted default values starts filters only if known filters follow
+				// (i.e. '${CMD:cat a | grep b}'), and unquoted messages of required variables can contain '|'
+				for ; j < len(v) && v[j] != '}' && (v[j] != '|' || required || !isVarFilters(v, j)); j++ { //nolint
 				}
 				state = 0
 				if j == len(v) {
@@ -210,15 +375,25 @@ func expandVar(v string, resolv VarResolver, keepsVariables bool) (string, error
 				}
 				value := v[i:j]
 				i = j - 1
-				if v[j] == '}' {
-					vars = append(vars, vvv{
-						start: varStarts,
-						end:   j + 1,
-						name:  varName,
-						def:   string(value),
-						tag:   guessScalarNodeTag(value),
-					})
+				va := vvv{
+					start:  varStarts,
+					end:    j + 1,
+					name:   varName,
+					def:    string(value),
+					hasDef: len(value) != 0,
+					tag:    guessScalarNodeTag(value),
 				}
+				if required {
+					va.tag = "str"
+					va.required = true
+				}
+				if v[j] == '|' {
+					if j = va.setFilters(v, j); j < 0 {
+						continue
+					}
+					i = j
+				}
+				vars = append(vars, va)
 			}
 		}
 	}
@@ -230,11 +405,31 @@ func expandVar(v string, resolv VarResolver, keepsVariables bool) (string, error
 	var ret []byte
 	for _, vv := range vars {
 		ret = append(ret, v[offset:vv.start]...)
-		resolved, err := resolv(vv.name)
+		resolved, tag, err := lookup.Lookup(vv.name)
+		if err == nil && len(tag) != 0 {
+			vv.tag = tag
+		}
+		if vv.required {
+			if err != nil && !errors.Is(err, ErrVarNotFound) {
+				return "", err
+			}
+			if keepsVariables {
+				ret = append(ret, v[vv.start:vv.end]...)
+				offset = vv.end
+				continue
+			}
+			if err != nil || len(resolved) == 0 {
+				message := vv.def
+				if len(message) == 0 {
+					message = fmt.Sprintf("%s is required", vv.name)
+				}
+				return "", ErrVarNotFound.New("%s: %s", nil, where, message)
+			}
+		}
 		if err != nil {
 			resolved = vv.def
 			if errors.Is(err, ErrVarNotFound) {
-				if len(vv.def) == 0 && !keepsVariables {
+				if !vv.hasDef && !keepsVariables && !vv.hasFilter("default") {
 					return "", err
 				}
 			} else {
@@ -242,21 +437,37 @@ func expandVar(v string, resolv VarResolver, keepsVariables bool) (string, error
 			}
 		}
 		isSingleVariable := len(vars) == 1 && vv.end == len(v) && vv.start == 0
+		if !keepsVariables && len(vv.filters) != 0 {
+			resolved, vv.tag, err = applyVarFilters(resolved, vv.tag, vv.filters, where)
+			if err != nil {
+				return "", err
+			}
+			if vv.tag == "seq" {
+				if !isSingleVariable {
+					return "", ErrYAML.New("%s: split filter can not be used in a string", nil, where)
+				}
+				ret = append(ret, resolved...)
+				offset = vv.end
+				continue
+			}
+		}
 		if !keepsVariables {
 			if len(resolved) == 0 && isSingleVariable {
 				ret = append(ret, `""`...)
 			} else if vv.tag == "str" && isSingleVariable && shouldQuote(resolved) {
-				ret = append(ret, quote(resolved)...)
+				ret = append(ret, strconv.Quote(resolved)...)
 			} else {
 				ret = append(ret, resolved...)
 			}
 		} else {
-			if len(resolved) == 0 {
-				ret = append(ret, fmt.Sprintf("${%s}", vv.name)...)
+			if len(resolved) == 0 && vv.hasDef {
+				ret = append(ret, fmt.Sprintf(`${%s:""%s}`, vv.name, vv.filterText)...)
+			} else if len(resolved) == 0 {
+				ret = append(ret, fmt.Sprintf("${%s%s}", vv.name, vv.filterText)...)
 			} else if vv.tag == "str" && shouldQuote(resolved) {
-				ret = append(ret, fmt.Sprintf("${%s:%s}", vv.name, quote(resolved))...)
+				ret = append(ret, fmt.Sprintf("${%s:%s%s}", vv.name, quote(resolved), vv.filterText)...)
 			} else {
-				ret = append(ret, fmt.Sprintf("${%s:%s}", vv.name, resolved)...)
+				ret = append(ret, fmt.Sprintf("${%s:%s%s}", vv.name, resolved, vv.filterText)...)
 			}
 		}
 		offset = vv.end
@@ -293,10 +504,22 @@ func parseVarString(v string, i int, q byte) ([]byte, int) {
 	return buf, -1
 }
 
+// parseVarValue returns the value and its tag like default values.
+// A double-quoted value is a string.
+func parseVarValue(s string) (string, string) {
+	if len(s) > 1 && s[0] == '"' {
+		if value, end := parseVarString(s, 0, '"'); end == len(s) {
+			return string(value), "str"
+		}
+	}
+	return s, guessScalarNodeTag(s)
+}
+
 var space = regexp.MustCompile(`\s`)
 
 func shouldQuote(s string) bool {
-	return strings.Contains(s, "}") || strings.Contains(s, "\"") || guessScalarNodeTag(s) != "str" || space.MatchString(s)
+	return strings.Contains(s, "}") || strings.Contains(s, "\"") || strings.Contains(s, "|") ||
+		guessScalarNodeTag(s) != "str" || space.MatchString(s)
 }
 
 func quote(s string) string {
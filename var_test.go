@@ -1,10 +1,13 @@
 package yammy_test
 
 import (
+	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
 
 	. "github.com/yuin/yammy"
+	"go.yaml.in/yaml/v3"
 )
 
 func TestStringVar(t *testing.T) {
@@ -85,6 +88,7 @@ func TestDefaultStringVar(t *testing.T) {
 		"test.yml": []byte(`
 test:
   value: ${KEY:"a\"\\na}"}
+  empty: ${KEY:""}
 `),
 	})
 	var result map[any]any
@@ -96,6 +100,9 @@ test:
 	if "a\"\\na}" != result["test"].(map[string]any)["value"] {
 		t.Error("failed to evaluate variables")
 	}
+	if "" != result["test"].(map[string]any)["empty"] {
+		t.Error("failed to evaluate an empty default value")
+	}
 }
 
 func TestVarNotFound(t *testing.T) {
@@ -280,3 +287,695 @@ vvalue: ${vname}
 		t.Error("failed to evaluate variables")
 	}
 }
+
+func TestRequiredVar(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+db:
+  host: ${DB_HOST:?set DB_HOST to the database address}
+  port: ${DB_PORT:?}
+  name: '${DB_NAME:?"set DB_NAME: the database name"}'
+  mode: ${DB_MODE:?set DB_MODE to ro|rw}
+`),
+	})
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_NAME", "app")
+	t.Setenv("DB_MODE", "rw")
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := result["db"].(map[string]any)
+	if "localhost" != db["host"] || "5432" != db["port"] || "app" != db["name"] {
+		t.Errorf("failed to evaluate variables: %#v", db)
+	}
+
+	t.Setenv("DB_HOST", "")
+	err = Load("test.yml", &result, WithFileSystem(fs))
+	if err == nil || "variable not found: test.yml(line:3): /db/host: "+
+		"set DB_HOST to the database address: yammy error" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+	var yerr *Error
+	if !errors.As(err, &yerr) || yerr.Line != 3 || yerr.Path != "/db/host" {
+		t.Errorf("err should have a position: %#v", yerr)
+	}
+
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "")
+	err = Load("test.yml", &result, WithFileSystem(fs))
+	if err == nil || "variable not found: test.yml(line:4): /db/port: DB_PORT is required: yammy error" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_NAME", "")
+	err = Load("test.yml", &result, WithFileSystem(fs))
+	if err == nil || "variable not found: test.yml(line:5): /db/name: "+
+		"set DB_NAME: the database name: yammy error" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+
+	t.Setenv("DB_NAME", "app")
+	t.Setenv("DB_MODE", "")
+	err = Load("test.yml", &result, WithFileSystem(fs))
+	if err == nil || "variable not found: test.yml(line:6): /db/mode: "+
+		"set DB_MODE to ro|rw: yammy error" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+
+	err = Load("test.yml", &result, WithFileSystem(fs), WithKeepsVariables())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if `${DB_NAME:?"set DB_NAME: the database name"}` != result["db"].(map[string]any)["name"] {
+		t.Errorf("required variables should be kept: %#v", result["db"])
+	}
+}
+
+func TestReferenceVar(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - base.yml
+  patches:
+    - op: replace
+      path: /service/port
+      value: 8443
+client:
+  url: http://${/service/host}:${.service.port}/${.service.name}
+  port: ${/service/port}
+  tls: ${.service.tls}
+  name: ${.service.name}
+  missing: ${/service/missing:none}
+`),
+		"base.yml": []byte(`
+service:
+  name: ${/service/prefix}-${NAME}
+  prefix: app
+  host: localhost
+  port: 8080
+  tls: true
+`),
+	})
+	var result map[string]any
+	t.Setenv("NAME", "api")
+	err := Load("test.yml", &result, WithFileSystem(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := json.Marshal(result["client"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"missing":"none","name":"app-api","port":8443,"tls":true,"url":"http://localhost:8443/app-api"}`
+	if expected != string(bs) {
+		t.Errorf("expected:\n--------------\n%s\n\nactual:\n---------------\n%s\n",
+			expected, string(bs))
+	}
+}
+
+func TestReferenceVarError(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"cycle.yml": []byte(`
+a: ${/b}
+b: x${.c}
+c: ${/a}
+`),
+		"mapping.yml": []byte(`
+a: ${/b}
+b:
+  c: 1
+`),
+		"notfound.yml": []byte(`
+a: ${/b}
+`),
+	})
+	cases := []struct {
+		file     string
+		expected string
+	}{
+		{
+			file:     "cycle.yml",
+			expected: "directive error: reference cycle detected: /a -> /b -> /c -> /a: yammy error",
+		},
+		{
+			file:     "mapping.yml",
+			expected: "directive error: reference /b must be a scalar node: yammy error",
+		},
+		{
+			file:     "notfound.yml",
+			expected: "variable not found: /b not found: yammy error",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.file, func(t *testing.T) {
+			var result map[string]any
+			err := Load(tt.file, &result, WithFileSystem(fs))
+			if err == nil || tt.expected != err.Error() {
+				t.Errorf("unexpected error message: %v", err)
+			}
+		})
+	}
+
+	var result map[string]any
+	err := Load("cycle.yml", &result, WithFileSystem(fs))
+	var yerr *Error
+	if !errors.As(err, &yerr) || yerr.Path != "/c" || yerr.Line != 4 {
+		t.Errorf("err should have a position of the cycle: %#v", yerr)
+	}
+}
+
+func TestNonScalarVar(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - vars.yml
+    - app.yml
+metadata:
+  labels: ${common_labels}
+args: ${common_args}
+`),
+		"vars.yml": []byte(`
+_directives:
+  variables:
+    common_labels:
+      app: ${APP:test}
+      team: core
+    common_args:
+      - --verbose
+`),
+		"app.yml": []byte(`
+spec:
+  labels: ${common_labels}
+`),
+	})
+	var n yaml.Node
+	err := Load("test.yml", &n, WithFileSystem(fs), WithSourceMapComment())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := yaml.Marshal(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `args: #  test.yml:8
+    - --verbose #  vars.yml:8
+metadata: #  test.yml:6
+    labels: #  test.yml:7
+        app: test #  vars.yml:5
+        team: core #  vars.yml:6
+spec: #  app.yml:2
+    labels: #  app.yml:3
+        app: test #  vars.yml:5
+        team: core #  vars.yml:6
+`
+	if expected != string(bs) {
+		t.Errorf("expected:\n--------------\n%s\n\nactual:\n---------------\n%s\n",
+			expected, string(bs))
+	}
+
+	t.Setenv("common_args", "--quiet")
+	var result map[string]any
+	err = Load("test.yml", &result, WithFileSystem(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if "--quiet" != result["args"] {
+		t.Errorf("environment variables should take precedence: %#v", result["args"])
+	}
+}
+
+func TestNonScalarVarCycle(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  variables:
+    a:
+      b: ${b}
+    b:
+      - ${a}
+value: ${a}
+`),
+	})
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs))
+	if err == nil || "directive error: variable cycle detected: a -> b -> a: yammy error" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+func TestVarFilters(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+test:
+  upper: ${NAME|upper}
+  lower: ${NAME:Default|lower}
+  trim: ${SPACES|trim}
+  b64enc: ${SECRET|b64enc}
+  b64dec: ${ENCODED|b64dec}
+  int: ${PORT|int}
+  quote: ${PORT|quote}
+  default: ${EMPTY|default:fallback}
+  default2: ${UNDEFINED|default:10}
+  split: ${LIST|split:","}
+  split2: ${LIST|split:"|"}
+  trimprefix: ${DIR|trimprefix:/}
+  trimsuffix: ${DIR:"/a/b.yml"|trimsuffix:.yml|upper}
+  embedded: http://${HOST|lower}:${PORT|int}
+  pipe: ${CMD:cat a | grep b}
+  pipe2: ${CMD:a|b|upper}
+`),
+	})
+	t.Setenv("NAME", "Yammy")
+	t.Setenv("SPACES", "  value  ")
+	t.Setenv("SECRET", "secret")
+	t.Setenv("ENCODED", "c2VjcmV0")
+	t.Setenv("PORT", "8080")
+	t.Setenv("EMPTY", "")
+	t.Setenv("LIST", "a,b|c")
+	t.Setenv("DIR", "/etc/yammy")
+	t.Setenv("HOST", "LOCALHOST")
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := json.Marshal(result["test"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"b64dec":"secret","b64enc":"c2VjcmV0","default":"fallback","default2":10,` +
+		`"embedded":"http://localhost:8080","int":8080,"lower":"yammy","pipe":"cat a | grep b","pipe2":"A|B",` +
+		`"quote":"8080","split":["a","b|c"],"split2":["a,b","c"],"trim":"value","trimprefix":"etc/yammy",` +
+		`"trimsuffix":"/ETC/YAMMY","upper":"YAMMY"}`
+	if expected != string(bs) {
+		t.Errorf("expected:\n--------------\n%s\n\nactual:\n---------------\n%s\n",
+			expected, string(bs))
+	}
+
+	err = Load("test.yml", &result, WithFileSystem(fs), WithKeepsVariables())
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := result["test"].(map[string]any)
+	if "${NAME:Yammy|upper}" != test["upper"] {
+		t.Errorf("filters should be kept: %s", test["upper"])
+	}
+	if `${LIST:"a,b|c"|split:","}` != test["split"] {
+		t.Errorf("filters should be kept: %s", test["split"])
+	}
+	if "${UNDEFINED|default:10}" != test["default2"] {
+		t.Errorf("filters should be kept: %s", test["default2"])
+	}
+}
+
+func TestVarFilterError(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"unknown.yml": []byte(`
+value: ${NAME|unknown}
+`),
+		"int.yml": []byte(`
+value: ${NAME|int}
+`),
+		"split.yml": []byte(`
+value: a ${NAME|split:","}
+`),
+	})
+	t.Setenv("NAME", "aaa")
+	cases := []struct {
+		file     string
+		expected string
+	}{
+		{
+			file:     "unknown.yml",
+			expected: "yaml error: unknown.yml(line:2): /value: unknown variable filter unknown: yammy error",
+		},
+		{
+			file:     "int.yml",
+			expected: "yaml error: int.yml(line:2): /value: aaa is not an integer: yammy error",
+		},
+		{
+			file:     "split.yml",
+			expected: "yaml error: split.yml(line:2): /value: split filter can not be used in a string: yammy error",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.file, func(t *testing.T) {
+			var result map[string]any
+			err := Load(tt.file, &result, WithFileSystem(fs))
+			if err == nil || tt.expected != err.Error() {
+				t.Errorf("unexpected error message: %v", err)
+			}
+		})
+	}
+}
+
+func TestVarNamespaces(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - configs/app.yml
+  variables:
+    NAME: directive
+    labels:
+      app: test
+test:
+  env: ${env:NAME}
+  var: ${var:NAME}
+  plain: ${NAME}
+  missing: ${env:MISSING:10}
+  custom: ${vault:db/password|upper}
+  labels: ${var:labels}
+`),
+		"configs/app.yml": []byte(`
+app:
+  secret: ${file:secret.txt}
+  missing: ${file:missing.txt:none}
+`),
+		"configs/secret.txt": []byte("s3cret\n"),
+	})
+	t.Setenv("NAME", "env")
+	vault := func(key string) (string, error) {
+		if key == "db/password" {
+			return "password", nil
+		}
+		return "", ErrVarNotFound.New("%s not found", nil, key)
+	}
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs), WithVarNamespace("vault", vault))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"app":{"missing":"none","secret":"s3cret"},"test":{"custom":"PASSWORD","env":"env",` +
+		`"labels":{"app":"test"},"missing":10,"plain":"env","var":"directive"}}`
+	if expected != string(bs) {
+		t.Errorf("expected:\n--------------\n%s\n\nactual:\n---------------\n%s\n",
+			expected, string(bs))
+	}
+
+	err = Load("test.yml", &result, WithFileSystem(fs), WithKeepsVariables(), WithVarNamespace("vault", vault))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if "${var:NAME:directive}" != result["test"].(map[string]any)["var"] {
+		t.Errorf("namespaces should be kept: %#v", result["test"])
+	}
+}
+
+func TestDotEnvFiles(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - configs/app.yml
+  envFiles:
+    - base.env
+  variables:
+    DIRECTIVE: directive
+    PLAIN: directive
+test:
+  plain: ${PLAIN}
+  quoted: ${QUOTED}
+  single: ${SINGLE}
+  exported: ${EXPORTED}
+  multiline: ${MULTILINE}
+  comment: ${COMMENT}
+  directive: ${DIRECTIVE}
+  env: ${env:PLAIN}
+  process: ${PROCESS}
+  override: ${OVERRIDE}
+  app: ${APP}
+`),
+		"configs/app.yml": []byte(`
+_directives:
+  envFiles:
+    - app.env
+`),
+		"configs/app.env": []byte(`APP=app
+PLAIN=app
+`),
+		"base.env": []byte(`
+# comment
+PLAIN=plain
+QUOTED="a \"b\"\tc" # comment
+SINGLE='a \n b'
+export EXPORTED=exported
+MULTILINE="line1
+line2"
+COMMENT=value # comment
+PROCESS=dotenv
+OVERRIDE=base
+`),
+		"override.env": []byte(`OVERRIDE=option`),
+		"invalid.env":  []byte("A=1\nINVALID\n"),
+	})
+	t.Setenv("PROCESS", "process")
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs), WithDotEnvFiles("override.env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := json.Marshal(result["test"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"app":"app","comment":"value","directive":"directive","env":"plain","exported":"exported",` +
+		`"multiline":"line1\nline2","override":"option","plain":"plain","process":"process",` +
+		`"quoted":"a \"b\"\tc","single":"a \\n b"}`
+	if expected != string(bs) {
+		t.Errorf("expected:\n--------------\n%s\n\nactual:\n---------------\n%s\n",
+			expected, string(bs))
+	}
+
+	err = Load("test.yml", &result, WithFileSystem(fs), WithDotEnvFiles("invalid.env"))
+	if err == nil || "directive error: invalid.env(line:2): failed to parse a dotenv file: '=' is expected: "+
+		"yammy error" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+	var yerr *Error
+	if !errors.As(err, &yerr) || yerr.File != "invalid.env" || yerr.Line != 2 {
+		t.Errorf("err should have a position: %#v", yerr)
+	}
+}
+
+func TestWithVariables(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  variables:
+    NAME: directive
+    labels:
+      app: test
+test:
+  name: ${NAME}
+  port: ${PORT:"80"}
+  debug: ${DEBUG}
+  labels: ${labels}
+  var: ${var:NAME}
+  version: ${VERSION}
+`),
+	})
+	t.Setenv("NAME", "env")
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs),
+		WithVariables(map[string]string{"NAME": "first", "PORT": "8080"}),
+		WithVariables(map[string]string{"NAME": "override", "DEBUG": "true", "labels": "none",
+			"VERSION": `"1.0"`}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := json.Marshal(result["test"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"debug":true,"labels":"none","name":"override","port":8080,"var":"directive","version":"1.0"}`
+	if expected != string(bs) {
+		t.Errorf("expected:\n--------------\n%s\n\nactual:\n---------------\n%s\n",
+			expected, string(bs))
+	}
+}
+
+func TestVarPrecedence(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  envFiles:
+    - test.env
+  variables:
+    NAME: directive
+    DOTENV: directive
+test:
+  name: ${NAME}
+  dotenv: ${DOTENV}
+`),
+		"test.env": []byte("NAME=dotenv\nDOTENV=dotenv\n"),
+	})
+	t.Setenv("NAME", "env")
+	cases := []struct {
+		name       string
+		precedence []VarSource
+		expected   string
+	}{
+		{
+			name:     "default",
+			expected: `{"dotenv":"dotenv","name":"env"}`,
+		},
+		{
+			name:       "directive first",
+			precedence: []VarSource{VarSourceDirective, VarSourceEnv, VarSourceDotEnv},
+			expected:   `{"dotenv":"directive","name":"directive"}`,
+		},
+		{
+			name:       "without env",
+			precedence: []VarSource{VarSourceDotEnv, VarSourceDirective},
+			expected:   `{"dotenv":"dotenv","name":"dotenv"}`,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []LoadOption{WithFileSystem(fs)}
+			if tt.precedence != nil {
+				opts = append(opts, WithVarPrecedence(tt.precedence...))
+			}
+			var result map[string]any
+			err := Load("test.yml", &result, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bs, _ := json.Marshal(result["test"])
+			if tt.expected != string(bs) {
+				t.Errorf("expected:\n%s\nactual:\n%s", tt.expected, string(bs))
+			}
+		})
+	}
+
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs), WithVarPrecedence(VarSourceEnv, VarSource("unknown")))
+	if err == nil || "yammy error: unknown variable source: unknown" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+	err = Load("test.yml", &result, WithFileSystem(fs), WithVarPrecedence(VarSourceEnv, VarSourceEnv))
+	if err == nil || "yammy error: duplicated variable source: env" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+func TestEnvAllowlist(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+test:
+  allowed: ${APP_NAME}
+  denied: ${SECRET:denied}
+  namespace: ${env:SECRET:denied}
+`),
+	})
+	t.Setenv("APP_NAME", "app")
+	t.Setenv("SECRET", "secret")
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs), WithEnvAllowlist("APP_*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, _ := json.Marshal(result["test"])
+	if `{"allowed":"app","denied":"denied","namespace":"denied"}` != string(bs) {
+		t.Errorf("unexpected result: %s", string(bs))
+	}
+
+	fs = newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+test:
+  file: ${file:/proc/self/environ:none}
+`),
+	})
+	err = Load("test.yml", &result, WithFileSystem(fs), WithEnvAllowlist("APP_*"))
+	if err == nil || !strings.Contains(err.Error(), "file namespace can not be used with WithEnvAllowlist") {
+		t.Errorf("unexpected error message: %v", err)
+	}
+
+	err = Load("test.yml", &result, WithFileSystem(fs), WithEnvAllowlist("[APP"))
+	if err == nil || "yammy error: invalid env allowlist pattern: [APP: syntax error in pattern" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+func TestScopedVariables(t *testing.T) {
+	fs := newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  include:
+    - a.yml
+    - b.yml
+  variables:
+    env: prod
+root: ${env}-${region}
+`),
+		"a.yml": []byte(`
+_directives:
+  variables:
+    prefix: a
+    env: dev
+  include:
+    - region.yml
+a: ${prefix}-${env}
+`),
+		"region.yml": []byte(`
+_directives:
+  variables:
+    region: us
+    prefix: region
+  export:
+    - region
+region: ${prefix}-${region}
+`),
+		"b.yml": []byte(`
+b: ${prefix:none}-${region}
+`),
+	})
+	var result map[string]any
+	err := Load("test.yml", &result, WithFileSystem(fs), WithScopedVariables())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"a":"a-prod","b":"none-us","region":"a-us","root":"prod-us"}`
+	if expected != string(bs) {
+		t.Errorf("expected:\n--------------\n%s\n\nactual:\n---------------\n%s\n",
+			expected, string(bs))
+	}
+
+	err = Load("test.yml", &result, WithFileSystem(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, _ = json.Marshal(result)
+	expected = `{"a":"a-prod","b":"a-us","region":"a-us","root":"prod-us"}`
+	if expected != string(bs) {
+		t.Errorf("variables should be global without WithScopedVariables: %s", string(bs))
+	}
+
+	fs = newMockFS(map[string][]byte{
+		"test.yml": []byte(`
+_directives:
+  export:
+    - undefined
+`),
+	})
+	err = Load("test.yml", &result, WithFileSystem(fs), WithScopedVariables())
+	if err == nil || "directive error: test.yml(line:4): exported variable undefined is not defined: "+
+		"yammy error" != err.Error() {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}